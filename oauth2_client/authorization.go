@@ -0,0 +1,81 @@
+package oauth2_client
+
+import (
+    "net/url"
+    "strings"
+)
+
+// ParseAuthorizationHeader parses the parameters of an "OAuth" Authorization
+// header value as sent by clients and providers in the wild: the scheme is
+// matched case-insensitively, parameters may be separated by "," or ", "
+// with optional whitespace around "=" and ",", values may be quoted, with
+// backslash escapes, or bare, realm may appear anywhere, and values are
+// percent-decoded.  A "+" is kept as is rather than decoded as a space, as in
+// ParseTokenResponse, so that an unencoded base64 oauth_signature survives.
+func ParseAuthorizationHeader(value string) (url.Values, error) {
+    value = strings.TrimSpace(value)
+    if len(value) < 5 || !strings.EqualFold(value[:5], "OAuth") || (len(value) > 5 && value[5] != ' ' && value[5] != '\t') {
+        return nil, ErrNotOAuthAuthorization
+    }
+    s := value[5:]
+    params := make(url.Values)
+    for i := 0; i < len(s); {
+        // skip separators and whitespace
+        for i < len(s) && (s[i] == ',' || s[i] == ' ' || s[i] == '\t') {
+            i++
+        }
+        if i >= len(s) {
+            break
+        }
+        start := i
+        for i < len(s) && s[i] != '=' && s[i] != ',' {
+            i++
+        }
+        key := strings.TrimSpace(s[start:i])
+        if i >= len(s) || s[i] == ',' {
+            // a parameter without a value
+            if len(key) > 0 {
+                params.Add(decodeAuthorizationValue(key), "")
+            }
+            continue
+        }
+        i++ // skip '='
+        for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+            i++
+        }
+        var raw string
+        if i < len(s) && s[i] == '"' {
+            i++
+            var b strings.Builder
+            for i < len(s) && s[i] != '"' {
+                if s[i] == '\\' && i+1 < len(s) {
+                    i++
+                }
+                b.WriteByte(s[i])
+                i++
+            }
+            if i >= len(s) {
+                return nil, ErrMalformedAuthorization
+            }
+            i++ // skip closing quote
+            raw = b.String()
+        } else {
+            start = i
+            for i < len(s) && s[i] != ',' {
+                i++
+            }
+            raw = strings.TrimSpace(s[start:i])
+        }
+        if len(key) > 0 {
+            params.Add(decodeAuthorizationValue(key), decodeAuthorizationValue(raw))
+        }
+    }
+    return params, nil
+}
+
+func decodeAuthorizationValue(value string) string {
+    if decoded, err := url.PathUnescape(value); err == nil {
+        return decoded
+    }
+    return value
+}
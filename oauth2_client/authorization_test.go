@@ -0,0 +1,75 @@
+package oauth2_client
+
+import (
+    "net/http"
+    "net/url"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestParseAuthorizationHeader(t *testing.T) {
+    tests := []struct {
+        header string
+        params url.Values
+    }{
+        {
+            `OAuth realm="Photos", oauth_consumer_key="dpf43f3p2l4k3l03", oauth_signature="tR3%2BTy81lMeYAr%2FFid0kMTYa%2FWM%3D"`,
+            url.Values{"realm": {"Photos"}, "oauth_consumer_key": {"dpf43f3p2l4k3l03"}, "oauth_signature": {"tR3+Ty81lMeYAr/Fid0kMTYa/WM="}},
+        },
+        {
+            // an unencoded base64 signature keeps its "+"
+            `OAuth oauth_signature="tR3+Ty81lMeYAr/Fid0kMTYa/WM="`,
+            url.Values{"oauth_signature": {"tR3+Ty81lMeYAr/Fid0kMTYa/WM="}},
+        },
+        {
+            "  oauth   oauth_token = \"nnch734d00sl2jdk\" ,\toauth_nonce=\"kllo9940pd9333jh\",,  ",
+            url.Values{"oauth_token": {"nnch734d00sl2jdk"}, "oauth_nonce": {"kllo9940pd9333jh"}},
+        },
+        {
+            `OAUTH oauth_version=1.0,oauth_timestamp=1191242096, oauth_callback=oob`,
+            url.Values{"oauth_version": {"1.0"}, "oauth_timestamp": {"1191242096"}, "oauth_callback": {"oob"}},
+        },
+        {
+            `OAuth oauth_token="a\"b", realm="", oauth_body_hash`,
+            url.Values{"oauth_token": {`a"b`}, "realm": {""}, "oauth_body_hash": {""}},
+        },
+    }
+    for _, test := range tests {
+        params, err := ParseAuthorizationHeader(test.header)
+        if err != nil {
+            t.Errorf("%s: %v", test.header, err)
+            continue
+        }
+        if !reflect.DeepEqual(params, test.params) {
+            t.Errorf("%s: got %v, expected %v", test.header, params, test.params)
+        }
+    }
+    for _, header := range []string{"Basic dXNlcjpwYXNz", "OAuthx oauth_token=a", ""} {
+        if _, err := ParseAuthorizationHeader(header); err != ErrNotOAuthAuthorization {
+            t.Errorf("%q: expected ErrNotOAuthAuthorization, got %v", header, err)
+        }
+    }
+    if _, err := ParseAuthorizationHeader(`OAuth oauth_token="unterminated`); err != ErrMalformedAuthorization {
+        t.Errorf("expected ErrMalformedAuthorization, got %v", err)
+    }
+}
+
+func TestVerifyUnencodedSignature(t *testing.T) {
+    p := newPhotosClient()
+    params := url.Values{"file": {"vacation.jpg"}, "size": {"original"}}
+    v, err := oauth1PrepareRequest(p, p.CurrentCredentials(), GET, "http://photos.example.net/photos", params, time.Unix(1191242096, 0), "kllo9940pd9333jh", HMAC_SHA1)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if signature := v.Get("oauth_signature"); signature != "tR3+Ty81lMeYAr/Fid0kMTYa/WM=" {
+        t.Fatalf("got signature %q", signature)
+    }
+    req, _ := http.NewRequest(GET, "http://photos.example.net/photos?file=vacation.jpg&size=original", nil)
+    req.Header.Set("Authorization", `OAuth oauth_consumer_key="dpf43f3p2l4k3l03", oauth_token="nnch734d00sl2jdk", `+
+        `oauth_signature_method="HMAC-SHA1", oauth_signature="tR3+Ty81lMeYAr/Fid0kMTYa/WM=", `+
+        `oauth_timestamp="1191242096", oauth_nonce="kllo9940pd9333jh", oauth_version="1.0"`)
+    if err = VerifyRequest(p, req, p.CurrentCredentials()); err != nil {
+        t.Error(err)
+    }
+}
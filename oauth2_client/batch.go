@@ -0,0 +1,74 @@
+package oauth2_client
+
+import (
+    "context"
+    "io"
+    "net/http"
+    "net/url"
+    "sync"
+)
+
+// DefaultBatchConcurrency is the number of requests BatchDo runs at once.
+var DefaultBatchConcurrency = 4
+
+// RequestSpec describes one authorized request of a batch.
+type RequestSpec struct {
+    Method  string
+    Headers http.Header
+    Uri     string
+    Query   url.Values
+    Body    io.Reader
+}
+
+// Result is the outcome of one request of a batch.
+type Result struct {
+    Response *http.Response
+    Request  *http.Request
+    Err      error
+}
+
+// BatchDo signs and sends reqs concurrently using the current credentials
+// and HTTP client of client, running at most DefaultBatchConcurrency
+// requests at once.  The results are in the same order as reqs.  Once ctx
+// is done, in-flight requests are cancelled and requests that have not
+// started yet fail with ctx.Err().  The caller must close every non-nil
+// Response.Body.
+func BatchDo(ctx context.Context, client OAuth2Client, reqs []*RequestSpec) []Result {
+    results := make([]Result, len(reqs))
+    concurrency := DefaultBatchConcurrency
+    if concurrency <= 0 {
+        concurrency = 1
+    }
+    sem := make(chan struct{}, concurrency)
+    var wg sync.WaitGroup
+    for i, spec := range reqs {
+        select {
+        case sem <- struct{}{}:
+        case <-ctx.Done():
+        }
+        if err := ctx.Err(); err != nil {
+            results[i].Err = err
+            continue
+        }
+        wg.Add(1)
+        go func(i int, spec *RequestSpec) {
+            defer wg.Done()
+            defer func() { <-sem }()
+            results[i] = batchDoOne(ctx, client, spec)
+        }(i, spec)
+    }
+    wg.Wait()
+    return results
+}
+
+func batchDoOne(ctx context.Context, client OAuth2Client, spec *RequestSpec) Result {
+    if spec == nil {
+        return Result{Err: ErrNilRequestSpec}
+    }
+    req, err := createAuthorizedRequest(client, spec.Method, spec.Headers, spec.Uri, spec.Query, spec.Body)
+    if err != nil {
+        return Result{Request: req, Err: err}
+    }
+    resp, req, err := MakeRequest(client, req.WithContext(ctx))
+    return Result{Response: resp, Request: req, Err: err}
+}
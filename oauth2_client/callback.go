@@ -0,0 +1,89 @@
+package oauth2_client
+
+import (
+    "crypto/subtle"
+    "errors"
+    "net/http"
+)
+
+// HandleCallback completes the authorization flow from the request the
+// provider redirected the user back with, and returns the token credentials
+// (OAuth 1.0) or the access token (OAuth 2.0), which also become the
+// client's current ones.
+//
+// For OAuth 1.0 clients the oauth_token must be a request token whose
+// secret is in DefaultEphemeralStore, or ErrUnknownRequestToken is
+// returned; the exchange sets the current credentials, which fires the
+// OnCredentialsChanged hook.  For OAuth 2.0 clients the callback must carry
+// a state matching the client's State() if it has one, or else one returned
+// by NewOAuth2State, or ErrStateMismatch is returned.  A user who declined at the provider
+// yields ErrAccessDenied.
+func HandleCallback(client OAuth2Client, req *http.Request) (AuthToken, error) {
+    if req == nil || req.URL == nil {
+        return nil, errors.New("Request cannot be nil")
+    }
+    if p, ok := client.(OAuth1Client); ok {
+        return oauth1HandleCallback(p, req)
+    }
+    return oauth2HandleCallback(client, req)
+}
+
+func oauth1HandleCallback(p OAuth1Client, req *http.Request) (AuthToken, error) {
+    // twitter.com sends denied=<request token> when the user cancels
+    if len(req.URL.Query().Get("denied")) > 0 {
+        return nil, ErrAccessDenied
+    }
+    token, verifier := oauth1CallbackParams(req, "")
+    if len(token) <= 0 {
+        return nil, ErrNoCredentials
+    }
+    secret, ok := oauth1LookupStoredToken(token)
+    if !ok || (len(secret) <= 0 && !p.AllowEmptyTokenSecret()) {
+        return nil, ErrUnknownRequestToken
+    }
+    return OAuth1CompleteAuthorization(p, &stdAuthToken{token: token, secret: secret}, verifier)
+}
+
+func oauth2HandleCallback(client OAuth2Client, req *http.Request) (AuthToken, error) {
+    query := req.URL.Query()
+    if code := query.Get("error"); len(code) > 0 {
+        if code == "access_denied" {
+            return nil, ErrAccessDenied
+        }
+        message := query.Get("error_description")
+        if len(message) <= 0 {
+            message = code
+        }
+        return nil, &TokenError{Code: code, Message: message}
+    }
+    state := query.Get("state")
+    expected := ""
+    if c, ok := client.(interface {
+        State() string
+    }); ok {
+        expected = c.State()
+    }
+    // without a state the callback could have been forged by another site
+    if len(state) <= 0 {
+        return nil, ErrStateMismatch
+    }
+    if len(expected) > 0 {
+        if subtle.ConstantTimeCompare([]byte(state), []byte(expected)) != 1 {
+            return nil, ErrStateMismatch
+        }
+    } else if _, ok, err := ConsumeOAuth2State(state); err != nil {
+        return nil, err
+    } else if !ok {
+        return nil, ErrStateMismatch
+    }
+    if err := client.ExchangeRequestTokenForAccess(req); err != nil {
+        return nil, err
+    }
+    cred := &stdAuthToken{}
+    if c, ok := client.(interface {
+        AccessToken() string
+    }); ok {
+        cred.token = c.AccessToken()
+    }
+    return cred, nil
+}
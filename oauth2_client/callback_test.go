@@ -0,0 +1,69 @@
+package oauth2_client
+
+import (
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestOAuth2CallbackRequiresState(t *testing.T) {
+    for _, tc := range []struct {
+        clientState, target string
+    }{
+        {"", "/callback?code=abc"},
+        {"expected", "/callback?code=abc"},
+        {"expected", "/callback?code=abc&state=other"},
+        {"", "/callback?code=abc&state=unknown"},
+    } {
+        p := NewGoogleClient()
+        p.SetState(tc.clientState)
+        if _, err := HandleCallback(p, httptest.NewRequest("GET", tc.target, nil)); err != ErrStateMismatch {
+            t.Errorf("state %q, %s: err = %v, want ErrStateMismatch", tc.clientState, tc.target, err)
+        }
+    }
+}
+
+func TestOAuth1CallbackRejectsAccessToken(t *testing.T) {
+    p, srv := newTokenServerClient(func(w http.ResponseWriter, r *http.Request) {
+        io.WriteString(w, "oauth_token=callback-access&oauth_token_secret=access-secret")
+    })
+    defer srv.Close()
+    oauth1StoreTokenSecret("callback-request", "request-secret")
+    credentials, err := HandleCallback(p, httptest.NewRequest("GET", "/callback?oauth_token=callback-request&oauth_verifier=v", nil))
+    if err != nil || credentials.Token() != "callback-access" {
+        t.Fatalf("callback with the request token = %v, %v", credentials, err)
+    }
+    if _, err = HandleCallback(p, httptest.NewRequest("GET", "/callback?oauth_token=callback-access&oauth_verifier=v", nil)); err != ErrUnknownRequestToken {
+        t.Errorf("callback with the access token: err = %v, want ErrUnknownRequestToken", err)
+    }
+}
+
+// requestParserClient parses access token responses like request token
+// responses, as providers sharing one parser for both do.
+type requestParserClient struct{ *genericClient }
+
+func (p requestParserClient) ParseAccessTokenResult(value string) (AuthToken, error) {
+    return defaultOAuth1ParseRequestToken(value)
+}
+
+func TestOAuth1CallbackHookSeesAccessKind(t *testing.T) {
+    c, srv := newTokenServerClient(func(w http.ResponseWriter, r *http.Request) {
+        io.WriteString(w, "oauth_token=hook-access&oauth_token_secret=access-secret&oauth_callback_confirmed=true")
+    })
+    defer srv.Close()
+    p := requestParserClient{c}
+    var calls int
+    var kind CredentialKind
+    p.SetOnCredentialsChanged(func(AuthToken) {
+        calls++
+        kind = p.CredentialKind()
+    })
+    oauth1StoreTokenSecret("hook-request", "request-secret")
+    if _, err := HandleCallback(p, httptest.NewRequest("GET", "/callback?oauth_token=hook-request&oauth_verifier=v", nil)); err != nil {
+        t.Fatal(err)
+    }
+    if calls != 1 || kind != CREDENTIALS_ACCESS {
+        t.Errorf("hook called %d times with kind %v, want once with CREDENTIALS_ACCESS", calls, kind)
+    }
+}
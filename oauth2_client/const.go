@@ -2,13 +2,57 @@ package oauth2_client
 
 import (
     "sync"
+    "time"
 )
 
 const (
-    GET    = "GET"
-    POST   = "POST"
-    PUT    = "PUT"
-    DELETE = "DELETE"
+    GET     = "GET"
+    POST    = "POST"
+    PUT     = "PUT"
+    DELETE  = "DELETE"
+    HEAD    = "HEAD"
+    OPTIONS = "OPTIONS"
+
+    HMAC_SHA1   = "HMAC-SHA1"
+    HMAC_SHA256 = "HMAC-SHA256"
+    PLAINTEXT   = "PLAINTEXT"
+    RSA_SHA1    = "RSA-SHA1"
+
+    ACCEPT_FORM_ENCODED = "application/x-www-form-urlencoded"
+    ACCEPT_JSON         = "application/json"
+
+    SCOPE_IN_REQUEST_TOKEN     ScopePlacement = 0
+    SCOPE_IN_AUTHORIZATION_URL ScopePlacement = 1
+
+    PARAMS_IN_DEFAULT   ParamLocation = 0
+    PARAMS_IN_JSON_BODY ParamLocation = 1
+
+    CREDENTIALS_NONE      CredentialKind = 0
+    CREDENTIALS_TEMPORARY CredentialKind = 1
+    CREDENTIALS_ACCESS    CredentialKind = 2
+
+    TIMESTAMP_SECONDS      TimestampResolution = 0
+    TIMESTAMP_MILLISECONDS TimestampResolution = 1
+
+    DEFAULT_JSON_PARAMS_FIELD = "oauth"
+
+    LOG_LEVEL_DEBUG LogLevel = 0
+    LOG_LEVEL_INFO  LogLevel = 1
+    LOG_LEVEL_ERROR LogLevel = 2
+    LOG_LEVEL_NONE  LogLevel = 3
+
+    // how long a repeated callback for the same request token gets the
+    // access token of the first exchange
+    _OAUTH1_EXCHANGED_TOKEN_TTL = 5 * time.Minute
+
+    // how many distinct signing keys keep a pool of keyed HMAC hashers
+    _HMAC_POOL_LIMIT = 64
+
+    // keys and lifetimes of the values kept in DefaultEphemeralStore
+    _OAUTH1_SECRET_KEY_PREFIX = "oauth1.secret:"
+    _OAUTH1_TOKEN_SECRET_TTL  = time.Hour
+    _OAUTH2_STATE_KEY_PREFIX  = "oauth2.state:"
+    _OAUTH2_STATE_TTL         = time.Hour
 
     GOOGLE_SCOPE_FEEDS = "https://www.google.com/m8/feeds/"
 
@@ -22,6 +66,8 @@ const (
     _GOOGLE_AUTHORIZATION_CODE_METHOD = "POST"
     _GOOGLE_REFRESH_TOKEN_URL         = "https://accounts.google.com/o/oauth2/token"
     _GOOGLE_REFRESH_TOKEN_METHOD      = "POST"
+    _GOOGLE_REVOKE_TOKEN_URL          = "https://oauth2.googleapis.com/revoke"
+    _GOOGLE_REVOKE_TOKEN_METHOD       = "POST"
     _GOOGLE_USERINFO_URL              = "https://www.google.com/m8/feeds/contacts/default/full/?alt=json&max-results=0"
     _GOOGLE_USERINFO_METHOD           = "GET"
     _GOOGLE_USERINFO_FEED_REL         = "http://schemas.google.com/g/2005#feed"
@@ -32,6 +78,8 @@ const (
     _GOOGLEPLUS_AUTHORIZATION_CODE_METHOD = "POST"
     _GOOGLEPLUS_REFRESH_TOKEN_URL         = "https://accounts.google.com/o/oauth2/token"
     _GOOGLEPLUS_REFRESH_TOKEN_METHOD      = "POST"
+    _GOOGLEPLUS_REVOKE_TOKEN_URL          = "https://oauth2.googleapis.com/revoke"
+    _GOOGLEPLUS_REVOKE_TOKEN_METHOD       = "POST"
     _GOOGLEPLUS_USERINFO_URL              = "https://www.googleapis.com/plus/v1/people/me"
     _GOOGLEPLUS_USERINFO_METHOD           = "GET"
 
@@ -51,6 +99,7 @@ const (
     _TWITTER_ACCESS_TOKEN_METHOD           = "POST"
     _TWITTER_ACCESS_TOKEN_PROTECTED        = true
     _TWITTER_AUTHORIZATION_PATH_URL        = "https://api.twitter.com/oauth/authorize"
+    _TWITTER_AUTHENTICATE_PATH_URL         = "https://api.twitter.com/oauth/authenticate"
     _TWITTER_AUTHORIZED_RESOURCE_PROTECTED = true
     _TWITTER_USERINFO_URL                  = "http://api.twitter.com/1/account/verify_credentials.json"
     _TWITTER_USERINFO_METHOD               = "GET"
@@ -90,9 +139,10 @@ const (
 )
 
 var (
-    nonceLock              sync.Mutex
+    nonceSeedOnce          sync.Once
     nonceCounter           uint64
-    oauth1TokenSecretMap   map[string]*oauth1SecretInfo
+    exchangedTokensLock    sync.Mutex
+    exchangedTokens        map[string]*oauth1ExchangedInfo
     EnableLogHttpRequests  = false
     EnableLogHttpResponses = false
     EnableLogDebug         = false
@@ -0,0 +1,46 @@
+package oauth2_client
+
+import (
+    "net/http"
+    "sort"
+    "strings"
+)
+
+// AsCurl renders req, including its OAuth Authorization header and body, as
+// a curl command that can be pasted into a POSIX shell, e.g. to report a
+// failing request to a provider.  Reading the body leaves req able to be
+// sent.  The command contains the request's credentials.
+func AsCurl(req *http.Request) string {
+    if req == nil || req.URL == nil {
+        return ""
+    }
+    parts := []string{"curl"}
+    switch req.Method {
+    case "", GET:
+    case HEAD:
+        // with -X HEAD curl would wait for a body that never comes
+        parts = append(parts, "-I")
+    default:
+        parts = append(parts, "-X", shellQuote(req.Method))
+    }
+    keys := make([]string, 0, len(req.Header))
+    for k := range req.Header {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    for _, k := range keys {
+        for _, v := range req.Header[k] {
+            parts = append(parts, "-H", shellQuote(k+": "+v))
+        }
+    }
+    if body, err := readRequestBody(req); err == nil && len(body) > 0 {
+        parts = append(parts, "--data-binary", shellQuote(string(body)))
+    }
+    parts = append(parts, shellQuote(req.URL.String()))
+    return strings.Join(parts, " ")
+}
+
+// shellQuote single-quotes value for a POSIX shell.
+func shellQuote(value string) string {
+    return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,26 @@
+package oauth2_client
+
+import (
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestAsCurlMethods(t *testing.T) {
+    for _, tc := range []struct {
+        method, want string
+    }{
+        {GET, "curl 'https://api.example.com/photos'"},
+        {HEAD, "curl -I 'https://api.example.com/photos'"},
+        {DELETE, "curl -X 'DELETE' 'https://api.example.com/photos'"},
+    } {
+        req := httptest.NewRequest(tc.method, "https://api.example.com/photos", nil)
+        if got := AsCurl(req); got != tc.want {
+            t.Errorf("%s: got %s, want %s", tc.method, got, tc.want)
+        }
+    }
+    req := httptest.NewRequest(POST, "https://api.example.com/photos", strings.NewReader("file=it's.jpg"))
+    if got, want := AsCurl(req), `curl -X 'POST' --data-binary 'file=it'\''s.jpg' 'https://api.example.com/photos'`; got != want {
+        t.Errorf("got %s, want %s", got, want)
+    }
+}
@@ -0,0 +1,254 @@
+package oauth2_client
+
+import (
+    "encoding/json"
+    "encoding/xml"
+    "errors"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+)
+
+var (
+    ErrUnknownSignatureMethod     = errors.New("Unknown oauth_signature_method")
+    ErrMissingConsumerCredentials = errors.New("Consumer key and consumer secret are required")
+    ErrCallbackNotConfirmed       = errors.New("Provider did not return oauth_callback_confirmed=true")
+    ErrInvalidBodyHash            = errors.New("oauth_body_hash must be base64 encoded")
+    ErrInsecurePlaintext          = errors.New("PLAINTEXT signatures require an https URL")
+    ErrNotOAuthAuthorization      = errors.New("Authorization header does not use the OAuth scheme")
+    ErrMalformedAuthorization     = errors.New("Authorization header has an unterminated quoted value")
+    ErrSignerMethodMismatch       = errors.New("Signer used a different oauth_signature_method than the client")
+    ErrAmbiguousFormBody          = errors.New("Pass form fields either as url.Values or as a form-encoded reader, not both")
+    ErrEmptyTokenResponse         = errors.New("Token response has no oauth_token and oauth_token_secret")
+    ErrNilRequestSpec             = errors.New("RequestSpec cannot be nil")
+    ErrUnknownRequestToken        = errors.New("Callback oauth_token does not match a request token issued by this process")
+    ErrStateMismatch              = errors.New("Callback state does not match the state sent to the provider")
+    ErrAccessDenied               = errors.New("User denied access at the provider")
+    ErrEmptyTokenSecret           = errors.New("Credentials have an oauth_token but no secret; see SetAllowEmptyTokenSecret")
+    ErrResponseTooLarge           = errors.New("Response body exceeds the size limit")
+    ErrNoCredentials              = errors.New("Expected oauth_token")
+    ErrRateLimited                = errors.New("Provider rate limit exceeded")
+    ErrReplayedNonce              = errors.New("Provider rejected the oauth_nonce as already used")
+    ErrExpiredTimestamp           = errors.New("Provider rejected the oauth_timestamp as out of range")
+    ErrUnavailableHash            = errors.New("Hash function is not linked into the binary")
+    ErrSigningFailed              = errors.New("Delegated signer returned no signature")
+    ErrIncompleteCredentialsFile  = errors.New("Credentials file is incomplete")
+    ErrNoUserInfo                 = errors.New("Client has no user info endpoint")
+    ErrMissingSignature           = errors.New("Request has no oauth_signature")
+    ErrUnverifiableSignature      = errors.New("oauth_signature_method cannot be verified with the secrets")
+    ErrInvalidSignature           = errors.New("oauth_signature does not match the request")
+    ErrSelfVerifyFailed           = errors.New("Signed request failed its own signature check")
+)
+
+// TokenError is returned when a token exchange is rejected by the provider.
+// Code and Message are extracted from the response body by the first of
+// ErrorBodyParsers that recognizes it; otherwise Message is the raw body.
+type TokenError struct {
+    StatusCode int
+    Code       string
+    Message    string
+    Body       string
+    // Problem and ProblemAdvice are the oauth_problem and
+    // oauth_problem_advice of the OAuth Problem Reporting extension, e.g.
+    // "token_rejected", "timestamp_refused" or "nonce_used", taken from the
+    // body or the WWW-Authenticate header.
+    Problem       string
+    ProblemAdvice string
+    // MinAcceptableTimestamp and MaxAcceptableTimestamp are the range of
+    // oauth_acceptable_timestamps sent with timestamp_refused, in seconds
+    // since the epoch, or 0 if the provider did not send it.
+    MinAcceptableTimestamp int64
+    MaxAcceptableTimestamp int64
+}
+
+func (e *TokenError) Error() string {
+    if len(e.Code) > 0 {
+        return e.Code + ": " + e.Message
+    }
+    return e.Message
+}
+
+// Unwrap returns the sentinel error for the status or problem, if any, so
+// that callers can test for e.g. ErrRateLimited with errors.Is.
+func (e *TokenError) Unwrap() error {
+    if e.StatusCode == http.StatusTooManyRequests {
+        return ErrRateLimited
+    }
+    if err := problemSentinel(e.Problem); err != nil {
+        return err
+    }
+    return problemSentinel(e.Code)
+}
+
+// problemError is an oauth_problem found in an otherwise successful token
+// response.
+type problemError string
+
+func newProblemError(problem string) error { return problemError(problem) }
+
+func (e problemError) Error() string { return string(e) }
+func (e problemError) Unwrap() error { return problemSentinel(string(e)) }
+
+// problemSentinel maps an oauth_problem of the OAuth Problem Reporting
+// extension, or a provider's equivalent error code, to a sentinel error.
+func problemSentinel(problem string) error {
+    switch problem {
+    case "nonce_used":
+        return ErrReplayedNonce
+    case "timestamp_refused":
+        return ErrExpiredTimestamp
+    case "rate_limited", "rate_limit_exceeded", "88":
+        // 88 is twitter.com's "Rate limit exceeded"
+        return ErrRateLimited
+    }
+    return nil
+}
+
+// ErrorBodyParser extracts an error code and a human-readable message from
+// an error response body, returning ok=false if it does not recognize the
+// format.
+type ErrorBodyParser func(body string) (code, message string, ok bool)
+
+// ErrorBodyParsers are tried in order by newTokenError.
+var ErrorBodyParsers = []ErrorBodyParser{
+    ParseOAuthProblem,
+    ParseJSONErrorsArray,
+    ParseOAuth2JSONError,
+    ParseXMLError,
+}
+
+func newTokenError(statusCode int, body string) *TokenError {
+    e := &TokenError{StatusCode: statusCode, Message: body, Body: body}
+    for _, parser := range ErrorBodyParsers {
+        if code, message, ok := parser(body); ok {
+            e.Code = code
+            e.Message = message
+            break
+        }
+    }
+    if m, _ := ParseTokenResponse(strings.TrimSpace(body)); m != nil {
+        e.setProblem(m)
+    }
+    return e
+}
+
+// newTokenErrorFromResponse is like newTokenError, but also looks for the
+// problem in the WWW-Authenticate header.
+func newTokenErrorFromResponse(statusCode int, header http.Header, body string) *TokenError {
+    e := newTokenError(statusCode, body)
+    if len(e.Problem) <= 0 {
+        if m, err := ParseAuthorizationHeader(header.Get("WWW-Authenticate")); err == nil {
+            e.setProblem(m)
+            if len(e.Problem) > 0 && len(e.Code) <= 0 {
+                e.Code = e.Problem
+                e.Message = e.ProblemAdvice
+                if len(e.Message) <= 0 {
+                    e.Message = e.Problem
+                }
+            }
+        }
+    }
+    return e
+}
+
+// tokenErrorInBody returns a TokenError if body has one of the error shapes
+// recognized by ErrorBodyParsers or an oauth_problem, whatever the status,
+// since some providers report a failed exchange with a 200.
+func tokenErrorInBody(statusCode int, header http.Header, body string) error {
+    e := newTokenErrorFromResponse(statusCode, header, body)
+    if len(e.Code) <= 0 && len(e.Problem) <= 0 {
+        return nil
+    }
+    return e
+}
+
+func (e *TokenError) setProblem(m url.Values) {
+    if e.Problem = m.Get("oauth_problem"); len(e.Problem) <= 0 {
+        return
+    }
+    e.ProblemAdvice = m.Get("oauth_problem_advice")
+    if r := strings.SplitN(m.Get("oauth_acceptable_timestamps"), "-", 2); len(r) == 2 {
+        e.MinAcceptableTimestamp, _ = strconv.ParseInt(strings.TrimSpace(r[0]), 10, 64)
+        e.MaxAcceptableTimestamp, _ = strconv.ParseInt(strings.TrimSpace(r[1]), 10, 64)
+    }
+}
+
+// ParseOAuthProblem parses form-encoded oauth_problem bodies of the OAuth
+// Problem Reporting extension.
+func ParseOAuthProblem(body string) (string, string, bool) {
+    m, _ := ParseTokenResponse(strings.TrimSpace(body))
+    problem := m.Get("oauth_problem")
+    if len(problem) <= 0 {
+        return "", "", false
+    }
+    message := m.Get("oauth_problem_advice")
+    if len(message) <= 0 {
+        message = problem
+    }
+    return problem, message, true
+}
+
+// ParseJSONErrorsArray parses {"errors":[{"code":..,"message":..}]} bodies,
+// using the first error.
+func ParseJSONErrorsArray(body string) (string, string, bool) {
+    var v struct {
+        Errors []struct {
+            Code    json.RawMessage `json:"code"`
+            Message string          `json:"message"`
+        } `json:"errors"`
+    }
+    if err := json.Unmarshal([]byte(body), &v); err != nil || len(v.Errors) <= 0 {
+        return "", "", false
+    }
+    return jsonScalarString(v.Errors[0].Code), v.Errors[0].Message, true
+}
+
+// ParseOAuth2JSONError parses {"error":..,"error_description":..} bodies.
+func ParseOAuth2JSONError(body string) (string, string, bool) {
+    var v struct {
+        Error            string `json:"error"`
+        ErrorDescription string `json:"error_description"`
+    }
+    if err := json.Unmarshal([]byte(body), &v); err != nil || len(v.Error) <= 0 {
+        return "", "", false
+    }
+    message := v.ErrorDescription
+    if len(message) <= 0 {
+        message = v.Error
+    }
+    return v.Error, message, true
+}
+
+// ParseXMLError parses <error> bodies, either with <code> and <message>
+// children or with a code attribute and the message as text.
+func ParseXMLError(body string) (string, string, bool) {
+    var v struct {
+        XMLName  xml.Name
+        CodeAttr string `xml:"code,attr"`
+        Code     string `xml:"code"`
+        Message  string `xml:"message"`
+        Text     string `xml:",chardata"`
+    }
+    if err := xml.Unmarshal([]byte(body), &v); err != nil || v.XMLName.Local != "error" {
+        return "", "", false
+    }
+    code := v.Code
+    if len(code) <= 0 {
+        code = v.CodeAttr
+    }
+    message := v.Message
+    if len(message) <= 0 {
+        message = strings.TrimSpace(v.Text)
+    }
+    return code, message, true
+}
+
+// jsonScalarString returns a JSON string or number as a plain string.
+func jsonScalarString(data json.RawMessage) string {
+    var s string
+    if err := json.Unmarshal(data, &s); err == nil {
+        return s
+    }
+    return strings.TrimSpace(string(data))
+}
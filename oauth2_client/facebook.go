@@ -136,6 +136,8 @@ type facebookClient struct {
     expiresAt    time.Time "expires_at"
     tokenType    string    "token_type"
     refreshToken string    "refresh_token"
+    metrics      Metrics
+    correlation  string
 }
 
 func NewFacebookClient() *facebookClient {
@@ -160,6 +162,18 @@ func (p *facebookClient) Client() *http.Client {
     return p.client
 }
 
+func (p *facebookClient) Metrics() Metrics         { return p.metrics }
+func (p *facebookClient) SetMetrics(value Metrics) { p.metrics = value }
+
+func (p *facebookClient) CorrelationHeader() string        { return p.correlation }
+func (p *facebookClient) SetCorrelationHeader(name string) { p.correlation = name }
+
+func (p *facebookClient) SetMaxIdleConnsPerHost(value int) {
+    setMaxIdleConnsPerHost(p.Client(), value)
+}
+func (p *facebookClient) SetForceHTTP1(value bool)  { setForceHTTP1(p.Client(), value) }
+func (p *facebookClient) SetMaxRedirects(value int) { setMaxRedirects(p.Client(), value) }
+
 func (p *facebookClient) Initialize(properties jsonhelper.JSONObject) {
     if properties == nil || len(properties) <= 0 {
         return
@@ -241,6 +255,10 @@ func (p *facebookClient) ReadAccessTokenFromResponse(r *http.Response, now time.
         return err
     }
     body := string(body_bytes)
+    if err = tokenErrorInBody(r.StatusCode, r.Header, body); err != nil {
+        LogError("Received error in access token response: ", body)
+        return err
+    }
     return p.ReadAccessToken(body, now)
 }
 
@@ -0,0 +1,172 @@
+package oauth2_client
+
+import (
+    "encoding/json"
+    "fmt"
+    "github.com/pomack/jsonhelper.go/jsonhelper"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "net/url"
+    "strings"
+)
+
+// OAuth1ClientFile is the JSON credentials file read by
+// NewOAuth1ClientFromFile, e.g.
+//
+//	{
+//	    "consumer_key": "...",
+//	    "consumer_secret": "...",
+//	    "token": "...",
+//	    "token_secret": "...",
+//	    "request_token_url": "https://api.example.com/oauth/request_token",
+//	    "access_token_url": "https://api.example.com/oauth/access_token",
+//	    "authorization_url": "https://api.example.com/oauth/authorize"
+//	}
+//
+// The endpoints are only required without a token, since they are not used
+// once the token credentials are known.  The protocol parameters are sent in
+// the Authorization header unless params_in_query is true.
+type OAuth1ClientFile struct {
+    ServiceId          string `json:"service_id,omitempty"`
+    ConsumerKey        string `json:"consumer_key"`
+    ConsumerSecret     string `json:"consumer_secret"`
+    Token              string `json:"token,omitempty"`
+    TokenSecret        string `json:"token_secret,omitempty"`
+    CallbackUrl        string `json:"callback_url,omitempty"`
+    SignatureMethod    string `json:"signature_method,omitempty"`
+    Realm              string `json:"realm,omitempty"`
+    RequestTokenUrl    string `json:"request_token_url,omitempty"`
+    RequestTokenMethod string `json:"request_token_method,omitempty"`
+    AccessTokenUrl     string `json:"access_token_url,omitempty"`
+    AccessTokenMethod  string `json:"access_token_method,omitempty"`
+    AuthorizationUrl   string `json:"authorization_url,omitempty"`
+    ParamsInQuery      bool   `json:"params_in_query,omitempty"`
+}
+
+// NewOAuth1ClientFromFile returns a client for the provider and credentials
+// described by the OAuth1ClientFile at path, for command line tools that
+// keep their credentials in a file.
+func NewOAuth1ClientFromFile(path string) (OAuth1Client, error) {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    f, err := parseOAuth1ClientFile(data)
+    if err != nil {
+        return nil, fmt.Errorf("%s: %w", path, err)
+    }
+    return newGenericClient(f), nil
+}
+
+// parseOAuth1ClientFile decodes and validates an OAuth1ClientFile, listing
+// all of the missing fields in the error.
+func parseOAuth1ClientFile(data []byte) (*OAuth1ClientFile, error) {
+    f := new(OAuth1ClientFile)
+    if err := json.Unmarshal(data, f); err != nil {
+        return nil, err
+    }
+    var missing []string
+    if len(f.ConsumerKey) <= 0 {
+        missing = append(missing, "consumer_key")
+    }
+    if len(f.ConsumerSecret) <= 0 {
+        missing = append(missing, "consumer_secret")
+    }
+    if len(f.Token) > 0 && len(f.TokenSecret) <= 0 {
+        missing = append(missing, "token_secret")
+    }
+    if len(f.Token) <= 0 {
+        if len(f.RequestTokenUrl) <= 0 {
+            missing = append(missing, "request_token_url")
+        }
+        if len(f.AccessTokenUrl) <= 0 {
+            missing = append(missing, "access_token_url")
+        }
+        if len(f.AuthorizationUrl) <= 0 {
+            missing = append(missing, "authorization_url")
+        }
+    }
+    if len(missing) > 0 {
+        return nil, fmt.Errorf("%w: missing %s", ErrIncompleteCredentialsFile, strings.Join(missing, ", "))
+    }
+    return f, nil
+}
+
+// genericClient is an OAuth 1.0 client for a provider without a dedicated
+// client type, with the endpoints taken from an OAuth1ClientFile.
+type genericClient struct {
+    stdOAuth1Client
+    file *OAuth1ClientFile
+}
+
+func newGenericClient(f *OAuth1ClientFile) *genericClient {
+    p := &genericClient{file: f}
+    p.consumerKey = f.ConsumerKey
+    p.consumerSecret = f.ConsumerSecret
+    p.callbackUrl = f.CallbackUrl
+    p.signatureMethod = f.SignatureMethod
+    p.realm = f.Realm
+    p.currentCredentials = NewAuthToken(f.Token, f.TokenSecret)
+    if len(f.Token) > 0 {
+        p.credentialKind = CREDENTIALS_ACCESS
+    }
+    return p
+}
+
+func (p *genericClient) RequestUrl() string        { return p.file.RequestTokenUrl }
+func (p *genericClient) RequestUrlMethod() string  { return methodOrPost(p.file.RequestTokenMethod) }
+func (p *genericClient) RequestUrlProtected() bool { return !p.file.ParamsInQuery }
+func (p *genericClient) AccessUrl() string         { return p.file.AccessTokenUrl }
+func (p *genericClient) AccessUrlMethod() string   { return methodOrPost(p.file.AccessTokenMethod) }
+func (p *genericClient) AccessUrlProtected() bool  { return !p.file.ParamsInQuery }
+func (p *genericClient) AuthorizationUrl() string  { return p.file.AuthorizationUrl }
+func (p *genericClient) AuthorizedResourceProtected() bool {
+    return !p.file.ParamsInQuery
+}
+
+// ServiceId returns the service_id of the file, or else the host of the
+// first endpoint given.
+func (p *genericClient) ServiceId() string {
+    if len(p.file.ServiceId) > 0 {
+        return p.file.ServiceId
+    }
+    for _, uri := range []string{p.file.RequestTokenUrl, p.file.AccessTokenUrl, p.file.AuthorizationUrl} {
+        if u, err := url.Parse(uri); err == nil && len(u.Host) > 0 {
+            return u.Hostname()
+        }
+    }
+    return "oauth1"
+}
+
+// Initialize does nothing, since the client is configured from its file.
+func (p *genericClient) Initialize(properties jsonhelper.JSONObject) {}
+
+func (p *genericClient) GenerateRequestTokenUrl(properties jsonhelper.JSONObject) string {
+    return oauth1GenerateRequestTokenUrl(p, properties)
+}
+
+func (p *genericClient) RequestTokenGranted(req *http.Request) bool {
+    return oauth1RequestTokenGranted(p, req)
+}
+
+func (p *genericClient) ExchangeRequestTokenForAccess(req *http.Request) error {
+    return oauth1ExchangeRequestTokenForAccess(p, req)
+}
+
+func (p *genericClient) CreateAuthorizedRequest(method string, headers http.Header, uri string, query url.Values, r io.Reader) (*http.Request, error) {
+    return oauth1CreateAuthorizedRequest(p, method, headers, uri, query, r)
+}
+
+// RetrieveUserInfo returns ErrNoUserInfo, since there is no standard user
+// info endpoint to ask.
+func (p *genericClient) RetrieveUserInfo() (UserInfo, error) {
+    return nil, ErrNoUserInfo
+}
+
+func methodOrPost(method string) string {
+    if len(method) <= 0 {
+        return POST
+    }
+    return strings.ToUpper(method)
+}
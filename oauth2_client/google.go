@@ -80,6 +80,8 @@ type googleClient struct {
     expiresAt    time.Time "expires_at"
     tokenType    string    "token_type"
     refreshToken string    "refresh_token"
+    metrics      Metrics
+    correlation  string
 }
 
 type googleAuthorizationCodeResponse struct {
@@ -97,6 +99,18 @@ func (p *googleClient) Client() *http.Client {
     return p.client
 }
 
+func (p *googleClient) Metrics() Metrics         { return p.metrics }
+func (p *googleClient) SetMetrics(value Metrics) { p.metrics = value }
+
+func (p *googleClient) CorrelationHeader() string        { return p.correlation }
+func (p *googleClient) SetCorrelationHeader(name string) { p.correlation = name }
+
+func (p *googleClient) SetMaxIdleConnsPerHost(value int) {
+    setMaxIdleConnsPerHost(p.Client(), value)
+}
+func (p *googleClient) SetForceHTTP1(value bool)  { setForceHTTP1(p.Client(), value) }
+func (p *googleClient) SetMaxRedirects(value int) { setMaxRedirects(p.Client(), value) }
+
 func (p *googleClient) ClientId() string     { return p.clientId }
 func (p *googleClient) ClientSecret() string { return p.clientSecret }
 func (p *googleClient) RedirectUri() string  { return p.redirectUri }
@@ -202,10 +216,10 @@ func (p *googleClient) HandleClientAccept(code string) error {
         return err
     }
     s := new(googleAuthorizationCodeResponse)
-    err2 := json.NewDecoder(r.Body).Decode(s)
+    err2 := decodeTokenResponse(r, s)
     LogDebugf("Loaded response %T -> %#v", s, s)
     if err2 != nil {
-        LogError("Unable to decode the response from ", r.Body)
+        LogError("Unable to decode the authorization code response: ", err2)
         return err2
     }
     if len(s.AccessToken) > 0 && len(s.RefreshToken) > 0 {
@@ -251,7 +265,7 @@ func (p *googleClient) UpdateAccessToken() (string, error) {
             return "", err
         }
         s := new(googleAuthorizationCodeResponse)
-        err2 := json.NewDecoder(r.Body).Decode(s)
+        err2 := decodeTokenResponse(r, s)
         LogDebugf("Loaded response %T -> %#v", s, s)
         if err2 != nil {
             return "", err2
@@ -267,6 +281,20 @@ func (p *googleClient) UpdateAccessToken() (string, error) {
     return p.accessToken, nil
 }
 
+// RevokeToken revokes token at Google, which also revokes the tokens issued
+// alongside it, and forgets the client's tokens if token is one of them.
+func (p *googleClient) RevokeToken(token string, isRefresh bool) error {
+    if err := oauth2RevokeToken(p, _GOOGLE_REVOKE_TOKEN_METHOD, _GOOGLE_REVOKE_TOKEN_URL, p.clientId, p.clientSecret, token, isRefresh); err != nil {
+        return err
+    }
+    if token == p.accessToken || token == p.refreshToken {
+        p.accessToken = ""
+        p.refreshToken = ""
+        p.expiresAt = time.Time{}
+    }
+    return nil
+}
+
 func (p *googleClient) GenerateRequestTokenUrl(properties jsonhelper.JSONObject) string {
     if properties == nil {
         properties = jsonhelper.NewJSONObject()
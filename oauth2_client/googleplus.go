@@ -81,6 +81,8 @@ type googleplusClient struct {
     expiresAt    time.Time "expires_at"
     tokenType    string    "token_type"
     refreshToken string    "refresh_token"
+    metrics      Metrics
+    correlation  string
 }
 
 type googleplusAuthorizationCodeResponse struct {
@@ -98,6 +100,18 @@ func (p *googleplusClient) Client() *http.Client {
     return p.client
 }
 
+func (p *googleplusClient) Metrics() Metrics         { return p.metrics }
+func (p *googleplusClient) SetMetrics(value Metrics) { p.metrics = value }
+
+func (p *googleplusClient) CorrelationHeader() string        { return p.correlation }
+func (p *googleplusClient) SetCorrelationHeader(name string) { p.correlation = name }
+
+func (p *googleplusClient) SetMaxIdleConnsPerHost(value int) {
+    setMaxIdleConnsPerHost(p.Client(), value)
+}
+func (p *googleplusClient) SetForceHTTP1(value bool)  { setForceHTTP1(p.Client(), value) }
+func (p *googleplusClient) SetMaxRedirects(value int) { setMaxRedirects(p.Client(), value) }
+
 func (p *googleplusClient) ClientId() string     { return p.clientId }
 func (p *googleplusClient) ClientSecret() string { return p.clientSecret }
 func (p *googleplusClient) RedirectUri() string  { return p.redirectUri }
@@ -203,10 +217,10 @@ func (p *googleplusClient) HandleClientAccept(code string) error {
         return err
     }
     s := new(googleplusAuthorizationCodeResponse)
-    err2 := json.NewDecoder(r.Body).Decode(s)
+    err2 := decodeTokenResponse(r, s)
     LogDebugf("Loaded response %T -> %#v", s, s)
     if err2 != nil {
-        LogError("Unable to decode the response from ", r.Body)
+        LogError("Unable to decode the authorization code response: ", err2)
         return err2
     }
     if len(s.AccessToken) > 0 && len(s.RefreshToken) > 0 {
@@ -252,7 +266,7 @@ func (p *googleplusClient) UpdateAccessToken() (string, error) {
             return "", err
         }
         s := new(googleplusAuthorizationCodeResponse)
-        err2 := json.NewDecoder(r.Body).Decode(s)
+        err2 := decodeTokenResponse(r, s)
         LogDebugf("Loaded response %T -> %#v", s, s)
         if err2 != nil {
             return "", err2
@@ -268,6 +282,20 @@ func (p *googleplusClient) UpdateAccessToken() (string, error) {
     return p.accessToken, nil
 }
 
+// RevokeToken revokes token at Google, which also revokes the tokens issued
+// alongside it, and forgets the client's tokens if token is one of them.
+func (p *googleplusClient) RevokeToken(token string, isRefresh bool) error {
+    if err := oauth2RevokeToken(p, _GOOGLEPLUS_REVOKE_TOKEN_METHOD, _GOOGLEPLUS_REVOKE_TOKEN_URL, p.clientId, p.clientSecret, token, isRefresh); err != nil {
+        return err
+    }
+    if token == p.accessToken || token == p.refreshToken {
+        p.accessToken = ""
+        p.refreshToken = ""
+        p.expiresAt = time.Time{}
+    }
+    return nil
+}
+
 func (p *googleplusClient) GenerateRequestTokenUrl(properties jsonhelper.JSONObject) string {
     if properties == nil {
         properties = jsonhelper.NewJSONObject()
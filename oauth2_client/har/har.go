@@ -0,0 +1,146 @@
+// Package har rebuilds requests captured as HAR entries, or from their
+// parts, and signs them again with fresh OAuth 1.0 parameters, e.g. to replay
+// a request that failed in production.  Together with oauth2_client.AsCurl
+// it is meant for debugging and is not needed to use the client.
+package har
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "github.com/pomack/oauth2_client.go/oauth2_client"
+    "net/http"
+    "net/url"
+    "strings"
+)
+
+var ErrNoRequest = errors.New("HAR entry has no request")
+
+// Entry is the part of a HAR 1.2 log entry needed to rebuild its request.
+type Entry struct {
+    Request *Request `json:"request"`
+}
+
+type Request struct {
+    Method   string      `json:"method"`
+    Url      string      `json:"url"`
+    Headers  []NameValue `json:"headers"`
+    PostData *PostData   `json:"postData,omitempty"`
+}
+
+type NameValue struct {
+    Name  string `json:"name"`
+    Value string `json:"value"`
+}
+
+type PostData struct {
+    MimeType string `json:"mimeType"`
+    Text     string `json:"text"`
+}
+
+// ParseEntries returns the entries of a HAR file, as exported by the browser
+// developer tools, or of a single entry.
+func ParseEntries(data []byte) ([]*Entry, error) {
+    var v struct {
+        Log *struct {
+            Entries []*Entry `json:"entries"`
+        } `json:"log"`
+        Request *Request `json:"request"`
+    }
+    if err := json.Unmarshal(data, &v); err != nil {
+        return nil, err
+    }
+    if v.Log != nil {
+        return v.Log.Entries, nil
+    }
+    if v.Request != nil {
+        return []*Entry{{Request: v.Request}}, nil
+    }
+    return nil, ErrNoRequest
+}
+
+// SignFromHAR rebuilds the request of entry and signs it with the current
+// credentials of p.
+func SignFromHAR(p oauth2_client.OAuth1Client, entry *Entry) (*http.Request, error) {
+    if entry == nil || entry.Request == nil {
+        return nil, ErrNoRequest
+    }
+    r := entry.Request
+    headers := make(http.Header)
+    for _, h := range r.Headers {
+        headers.Add(h.Name, h.Value)
+    }
+    var body []byte
+    if r.PostData != nil {
+        body = []byte(r.PostData.Text)
+        if len(headers.Get("Content-Type")) <= 0 && len(r.PostData.MimeType) > 0 {
+            headers.Set("Content-Type", r.PostData.MimeType)
+        }
+    }
+    return SignFromTemplate(p, r.Method, r.Url, headers, body)
+}
+
+// SignFromTemplate builds a request from its method, URL, headers and body
+// and signs it with the current credentials of p using
+// oauth2_client.OAuth1Authorize.  The Authorization header and any protocol
+// parameters of the captured signature in the query or a form-encoded body
+// are replaced, and the headers the transport sets, such as Content-Length,
+// are dropped.  A captured Host header replaces the host of uri, so that the
+// request is signed for the host it is sent to.
+func SignFromTemplate(p oauth2_client.OAuth1Client, method, uri string, headers http.Header, body []byte) (*http.Request, error) {
+    if len(method) <= 0 {
+        method = oauth2_client.GET
+    }
+    var host string
+    h := make(http.Header)
+    for k, arr := range headers {
+        if strings.HasPrefix(k, ":") {
+            // an HTTP/2 pseudo-header such as :authority
+            continue
+        }
+        switch k = http.CanonicalHeaderKey(k); k {
+        case "Host":
+            host = arr[0]
+        case "Authorization", "Content-Length", "Connection", "Transfer-Encoding":
+        default:
+            h[k] = append(h[k], arr...)
+        }
+    }
+    if len(body) > 0 && strings.HasPrefix(h.Get("Content-Type"), oauth2_client.ACCEPT_FORM_ENCODED) {
+        form, err := url.ParseQuery(string(body))
+        if err != nil {
+            return nil, err
+        }
+        if stripProtocolParams(form) {
+            body = []byte(form.Encode())
+        }
+    }
+    req, err := http.NewRequest(method, uri, bytes.NewReader(body))
+    if err != nil {
+        return nil, err
+    }
+    if len(host) > 0 {
+        req.URL.Host, req.Host = host, host
+    }
+    if len(body) <= 0 {
+        req.Body, req.GetBody, req.ContentLength = http.NoBody, nil, 0
+    }
+    req.Header = h
+    if err = oauth2_client.OAuth1Authorize(p, req); err != nil {
+        return nil, err
+    }
+    return req, nil
+}
+
+// stripProtocolParams removes realm and the oauth_* parameters from form,
+// reporting whether there were any.
+func stripProtocolParams(form url.Values) bool {
+    found := false
+    for k := range form {
+        if k == "realm" || strings.HasPrefix(k, "oauth_") {
+            delete(form, k)
+            found = true
+        }
+    }
+    return found
+}
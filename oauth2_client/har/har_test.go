@@ -0,0 +1,100 @@
+package har
+
+import (
+    "github.com/pomack/oauth2_client.go/oauth2_client"
+    "io/ioutil"
+    "net/url"
+    "testing"
+)
+
+const testHAR = `{
+  "log": {
+    "version": "1.2",
+    "entries": [
+      {
+        "request": {
+          "method": "POST",
+          "url": "https://api.example.com/1.1/statuses/update.json?include_entities=true",
+          "headers": [
+            {"name": ":authority", "value": "api.example.com"},
+            {"name": "Host", "value": "upload.example.com"},
+            {"name": "Authorization", "value": "OAuth oauth_consumer_key=\"old\", oauth_signature=\"stale\""},
+            {"name": "Content-Length", "value": "64"}
+          ],
+          "postData": {
+            "mimeType": "application/x-www-form-urlencoded",
+            "text": "status=Hello%20Ladies%20%2B%20Gentlemen&oauth_nonce=stale"
+          }
+        }
+      }
+    ]
+  }
+}`
+
+func newTestClient() oauth2_client.OAuth1Client {
+    p := oauth2_client.NewTwitterClient().(oauth2_client.OAuth1Client)
+    p.SetConsumerKey("xvz1evFS4wEEPTGEFPHBog")
+    p.SetConsumerSecret("kAcSOqF21Fu85e7zjz7ZN2U4ZRhfV3WpwPAoE3Z7kBw")
+    p.SetCurrentCredentials(oauth2_client.NewAuthToken("370773112-GmHxMAgYyLbNEtIKZeRNFsMKPR9EyMZeS9weJAEb", "LswwdoUaIvS8ltyTt5jkRh4J50vUPVVHtR2YPi5kE"))
+    return p
+}
+
+func TestParseEntries(t *testing.T) {
+    entries, err := ParseEntries([]byte(testHAR))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(entries) != 1 || entries[0].Request.Method != "POST" || len(entries[0].Request.Headers) != 4 {
+        t.Fatalf("got entries %+v", entries)
+    }
+    single, err := ParseEntries([]byte(`{"request": {"method": "GET", "url": "https://api.example.com/"}}`))
+    if err != nil || len(single) != 1 || single[0].Request.Url != "https://api.example.com/" {
+        t.Errorf("got %+v, %v for a single entry", single, err)
+    }
+    if _, err = ParseEntries([]byte(`{}`)); err != ErrNoRequest {
+        t.Errorf("expected ErrNoRequest, got %v", err)
+    }
+}
+
+func TestSignFromHAR(t *testing.T) {
+    entries, err := ParseEntries([]byte(testHAR))
+    if err != nil {
+        t.Fatal(err)
+    }
+    p := newTestClient()
+    req, err := SignFromHAR(p, entries[0])
+    if err != nil {
+        t.Fatal(err)
+    }
+    if req.URL.Host != "upload.example.com" || (len(req.Host) > 0 && req.Host != req.URL.Host) {
+        t.Errorf("sending to Host %q, URL host %q", req.Host, req.URL.Host)
+    }
+    params, err := oauth2_client.ParseAuthorizationHeader(req.Header.Get("Authorization"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if params.Get("oauth_consumer_key") != "xvz1evFS4wEEPTGEFPHBog" || params.Get("oauth_token") != "370773112-GmHxMAgYyLbNEtIKZeRNFsMKPR9EyMZeS9weJAEb" {
+        t.Errorf("signed with %v", params)
+    }
+    if signature := params.Get("oauth_signature"); len(signature) <= 0 || signature == "stale" {
+        t.Errorf("got oauth_signature %q", signature)
+    }
+    if len(req.Header.Get("Content-Length")) > 0 || len(req.Header.Get(":authority")) > 0 {
+        t.Errorf("captured transport headers were kept: %v", req.Header)
+    }
+    body, err := ioutil.ReadAll(req.Body)
+    if err != nil {
+        t.Fatal(err)
+    }
+    form, _ := url.ParseQuery(string(body))
+    if form.Get("status") != "Hello Ladies + Gentlemen" || len(form.Get("oauth_nonce")) > 0 {
+        t.Errorf("got body %q", body)
+    }
+    req, err = SignFromHAR(p, entries[0])
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err = oauth2_client.VerifyRequest(p, req, p.CurrentCredentials()); err != nil {
+        t.Errorf("the signature does not match the host that is sent: %v", err)
+    }
+}
@@ -2,7 +2,6 @@ package oauth2_client
 
 import (
     "encoding/json"
-    "errors"
     "github.com/pomack/jsonhelper.go/jsonhelper"
     "io"
     "net/http"
@@ -25,10 +24,7 @@ type LinkedInAccessTokenResult interface {
 }
 
 type linkedInRequestTokenResult struct {
-    stdAuthToken
-    requestAuthUrl    string
-    expiresAt         time.Time
-    callbackConfirmed bool
+    requestTokenFields
 }
 
 func (p *linkedInRequestTokenResult) RequestAuthUrl() string  { return p.requestAuthUrl }
@@ -36,8 +32,7 @@ func (p *linkedInRequestTokenResult) ExpiresAt() time.Time    { return p.expires
 func (p *linkedInRequestTokenResult) CallbackConfirmed() bool { return p.callbackConfirmed }
 
 type linkedInAccessTokenResult struct {
-    stdAuthToken
-    expiresAt time.Time
+    tokenFields
 }
 
 func (p *linkedInAccessTokenResult) ExpiresAt() time.Time { return p.expiresAt }
@@ -112,7 +107,7 @@ func (p *linkedInClient) Initialize(properties jsonhelper.JSONObject) {
         //p.Credentials.Secret = v
     }
     if v := properties.GetAsString("linkedin.oauth1.scope"); len(v) > 0 {
-        //p.Scope = v
+        p.scopes = parseScopes(v)
     }
     if v := properties.GetAsString("linkedin.client.token"); len(v) > 0 {
         p.currentCredentials.SetToken(v)
@@ -146,19 +141,19 @@ func (p *linkedInClient) ParseRequestTokenResult(value string) (AuthToken, error
     LogDebug("+++++++++++++++++++++++++++++++")
     LogDebug("LinkedIn Client parsing request token result")
     t := new(linkedInRequestTokenResult)
-    m, err := url.ParseQuery(value)
+    m, err := ParseTokenResponse(value)
     if m != nil {
         t.token = m.Get("oauth_token")
         t.secret = m.Get("oauth_token_secret")
         t.requestAuthUrl = m.Get("xoauth_request_auth_url")
-        t.callbackConfirmed = m.Get("callback_confirmed") == "true"
+        t.callbackConfirmed = m.Get("oauth_callback_confirmed") == "true" || m.Get("callback_confirmed") == "true"
         strExpiresIn := m.Get("oauth_expires_in")
         expiresIn, _ := strconv.ParseInt(strExpiresIn, 10, 64)
         if expiresIn > 0 {
             t.expiresAt = time.Now().Add(time.Second * time.Duration(expiresIn)).UTC()
         }
         if err == nil && len(m.Get("oauth_problem")) > 0 {
-            err = errors.New(m.Get("oauth_problem"))
+            err = newProblemError(m.Get("oauth_problem"))
         }
     }
     LogDebug("+++++++++++++++++++++++++++++++")
@@ -169,7 +164,7 @@ func (p *linkedInClient) ParseAccessTokenResult(value string) (AuthToken, error)
     LogDebug("+++++++++++++++++++++++++++++++")
     LogDebug("LinkedIn Client parsing access token result")
     t := new(linkedInAccessTokenResult)
-    m, err := url.ParseQuery(value)
+    m, err := ParseTokenResponse(value)
     if m != nil {
         t.token = m.Get("oauth_token")
         t.secret = m.Get("oauth_token_secret")
@@ -179,7 +174,7 @@ func (p *linkedInClient) ParseAccessTokenResult(value string) (AuthToken, error)
             t.expiresAt = time.Now().Add(time.Second * time.Duration(expiresIn)).UTC()
         }
         if err == nil && len(m.Get("oauth_problem")) > 0 {
-            err = errors.New(m.Get("oauth_problem"))
+            err = newProblemError(m.Get("oauth_problem"))
         }
     }
     LogDebug("+++++++++++++++++++++++++++++++")
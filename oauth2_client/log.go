@@ -2,40 +2,60 @@ package oauth2_client
 
 import (
     "log"
+    "strconv"
 )
 
+// LogLevel is the minimum severity logged by the Log* functions.
+type LogLevel int
+
+// SetLogLevel enables logging at level and above and disables everything
+// below it.  Debug logging is off by default.
+func SetLogLevel(level LogLevel) {
+    EnableLogDebug = level <= LOG_LEVEL_DEBUG
+    EnableLogInfo = level <= LOG_LEVEL_INFO
+    EnableLogError = level <= LOG_LEVEL_ERROR
+}
+
+// redactSecret hides a secret so that it can be logged safely.
+func redactSecret(value string) string {
+    if len(value) <= 0 {
+        return ""
+    }
+    return "<redacted " + strconv.Itoa(len(value)) + " bytes>"
+}
+
 func LogDebug(value ...interface{}) {
     if EnableLogDebug {
-        log.Print(value)
+        log.Print(value...)
     }
 }
 
 func LogDebugf(format string, value ...interface{}) {
     if EnableLogDebug {
-        log.Printf(format, value)
+        log.Printf(format, value...)
     }
 }
 
 func LogInfo(value ...interface{}) {
     if EnableLogInfo {
-        log.Print(value)
+        log.Print(value...)
     }
 }
 
 func LogInfof(format string, value ...interface{}) {
     if EnableLogInfo {
-        log.Printf(format, value)
+        log.Printf(format, value...)
     }
 }
 
 func LogError(value ...interface{}) {
     if EnableLogError {
-        log.Print(value)
+        log.Print(value...)
     }
 }
 
 func LogErrorf(format string, value ...interface{}) {
     if EnableLogError {
-        log.Printf(format, value)
+        log.Printf(format, value...)
     }
 }
@@ -0,0 +1,71 @@
+package oauth2_client
+
+import (
+    "net/http"
+    "time"
+)
+
+// Metrics receives a callback before and after every request dispatched
+// through MakeRequest, e.g. to feed request counters and latency histograms.
+type Metrics interface {
+    OnRequestStart(method, host string)
+    OnRequestComplete(method, host string, statusCode int, duration time.Duration, err error)
+}
+
+// MetricsClient is implemented by clients that accept a Metrics instance.
+type MetricsClient interface {
+    Metrics() Metrics
+    SetMetrics(value Metrics)
+}
+
+// RequestIdMetrics is implemented by Metrics that also want the correlation
+// id sent with a request, see SetCorrelationHeader.  OnRequestId is called
+// just before OnRequestStart.
+type RequestIdMetrics interface {
+    OnRequestId(method, host, requestId string)
+}
+
+// CorrelationClient is implemented by clients that can tag every request
+// with a unique id, e.g. to match log lines with a provider's support
+// ticket.
+type CorrelationClient interface {
+    CorrelationHeader() string
+    // SetCorrelationHeader sends a new id in the header name, such as
+    // "X-Request-Id", with each request that does not already have one.
+    // An empty name turns it off, which is the default.
+    SetCorrelationHeader(name string)
+}
+
+type noopMetrics struct{}
+
+func (p noopMetrics) OnRequestStart(method, host string) {}
+func (p noopMetrics) OnRequestComplete(method, host string, statusCode int, duration time.Duration, err error) {
+}
+
+// setCorrelationId adds the correlation header of client to req unless req
+// already has it, returning the id sent, or "" if there is none.
+func setCorrelationId(client OAuth2Client, req *http.Request) string {
+    c, ok := client.(CorrelationClient)
+    if !ok || len(c.CorrelationHeader()) <= 0 {
+        return ""
+    }
+    name := c.CorrelationHeader()
+    if id := req.Header.Get(name); len(id) > 0 {
+        return id
+    }
+    id := newNonce()
+    if req.Header == nil {
+        req.Header = make(http.Header)
+    }
+    req.Header.Set(name, id)
+    return id
+}
+
+func clientMetrics(client OAuth2Client) Metrics {
+    if c, ok := client.(MetricsClient); ok {
+        if m := c.Metrics(); m != nil {
+            return m
+        }
+    }
+    return noopMetrics{}
+}
@@ -2,13 +2,17 @@ package oauth2_client
 
 import (
     "bytes"
+    "encoding/json"
+    "fmt"
     "github.com/pomack/jsonhelper.go/jsonhelper"
     "io"
+    "io/ioutil"
     "log"
     "net/http"
     "net/http/httputil"
     "net/url"
     "strings"
+    "time"
 )
 
 type UserInfo interface {
@@ -47,6 +51,17 @@ func AuthorizedPostFormRequest(client OAuth2Client, headers http.Header, uri str
     if headers == nil {
         headers = make(http.Header)
     }
+    if _, ok := client.(OAuth1Client); ok {
+        // OAuth 1.0 signs form fields, so they have to be passed as
+        // parameters rather than as an already encoded body
+        merged := make(url.Values)
+        for _, values := range []url.Values{query, data} {
+            for k, arr := range values {
+                merged[k] = append(merged[k], arr...)
+            }
+        }
+        return AuthorizedRequest(client, POST, headers, uri, merged, nil)
+    }
     var bytes []byte = nil
     if data != nil {
         bytes = []byte(data.Encode())
@@ -85,44 +100,91 @@ func AuthorizedRequestBytes(client OAuth2Client, method string, headers http.Hea
     return AuthorizedRequest(client, method, headers, uri, query, r)
 }
 
+// AuthorizedRequest signs and sends a request.  The returned *http.Request
+// is the one that was sent, so its URL is the final URL including any
+// parameters placed in the query while signing; see FinalUrl.
 func AuthorizedRequest(client OAuth2Client, method string, headers http.Header, uri string, query url.Values, r io.Reader) (*http.Response, *http.Request, error) {
+    req, err := createAuthorizedRequest(client, method, headers, uri, query, r)
+    if err != nil {
+        return nil, req, err
+    }
+    return MakeRequest(client, req)
+}
+
+func createAuthorizedRequest(client OAuth2Client, method string, headers http.Header, uri string, query url.Values, r io.Reader) (*http.Request, error) {
+    // the client normalizes the case of method, see PreserveMethodCase
     if len(method) <= 0 {
         method = GET
     }
-    method = strings.ToUpper(method)
     if headers == nil {
         headers = make(http.Header)
     }
     if query == nil {
         query = make(url.Values)
     }
+    // the query of uri stays in uri, where the clients keep it as it is,
+    // so query only holds the values the caller passed
     if strings.Contains(uri, "?") {
         parsedUrl, err := url.Parse(uri)
         if err != nil {
-            return nil, nil, err
+            return nil, err
         }
         if len(parsedUrl.Scheme) > 0 && len(parsedUrl.Host) > 0 {
             uri = parsedUrl.String()
         } else {
-            uri = parsedUrl.Path
-        }
-        for k, arr := range parsedUrl.Query() {
-            for _, v := range arr {
-                query.Add(k, v)
+            // keep encoded segments such as %2F as they are
+            uri = parsedUrl.EscapedPath()
+            if len(parsedUrl.RawQuery) > 0 {
+                uri += "?" + parsedUrl.RawQuery
             }
         }
     }
-    req, err := client.CreateAuthorizedRequest(method, headers, uri, query, r)
+    return client.CreateAuthorizedRequest(method, headers, uri, query, r)
+}
+
+// AuthorizedTemplateRequest substitutes the {name} placeholders in
+// uriTemplate with the URL-encoded values from pathParams and then signs and
+// sends the request, so the signature covers the final URL.
+func AuthorizedTemplateRequest(client OAuth2Client, method string, headers http.Header, uriTemplate string, pathParams map[string]string, query url.Values, r io.Reader) (*http.Response, *http.Request, error) {
+    uri, err := expandUriTemplate(uriTemplate, pathParams)
     if err != nil {
-        return nil, req, err
+        return nil, nil, err
     }
-    return MakeRequest(client, req)
+    return AuthorizedRequest(client, method, headers, uri, query, r)
 }
 
+func expandUriTemplate(uriTemplate string, pathParams map[string]string) (string, error) {
+    var buf bytes.Buffer
+    s := uriTemplate
+    for {
+        start := strings.Index(s, "{")
+        if start < 0 {
+            break
+        }
+        end := strings.Index(s[start:], "}")
+        if end < 0 {
+            return "", fmt.Errorf("Unterminated path parameter in %q", uriTemplate)
+        }
+        name := s[start+1 : start+end]
+        value, ok := pathParams[name]
+        if !ok {
+            return "", fmt.Errorf("Missing path parameter %q for %q", name, uriTemplate)
+        }
+        buf.WriteString(s[:start])
+        buf.WriteString(url.PathEscape(value))
+        s = s[start+end+1:]
+    }
+    buf.WriteString(s)
+    return buf.String(), nil
+}
+
+// splitUrl returns uri without its query and a copy of query with the
+// parameters of the query of uri appended, leaving query unchanged.
 func splitUrl(uri string, query url.Values) (string, url.Values) {
-    parts := strings.SplitN(uri, "?", 1)
-    if query == nil {
-        query = make(url.Values)
+    parts := strings.SplitN(uri, "?", 2)
+    merged := make(url.Values)
+    for k, arr := range query {
+        merged[k] = append([]string(nil), arr...)
     }
     if len(parts) > 1 && len(parts[1]) > 0 {
         queryPart := strings.Replace(parts[1], "?", "&", -1)
@@ -130,12 +192,35 @@ func splitUrl(uri string, query url.Values) (string, url.Values) {
         if m != nil {
             for k, arr := range m {
                 for _, v := range arr {
-                    query.Add(k, v)
+                    merged.Add(k, v)
                 }
             }
         }
     }
-    return parts[0], query
+    return parts[0], merged
+}
+
+// subtractValues returns a copy of values without one occurrence of each of
+// the values in sub.
+func subtractValues(values, sub url.Values) url.Values {
+    result := make(url.Values)
+    for k, arr := range values {
+        remove := append([]string(nil), sub[k]...)
+        for _, v := range arr {
+            found := false
+            for i, s := range remove {
+                if s == v {
+                    remove = append(remove[:i], remove[i+1:]...)
+                    found = true
+                    break
+                }
+            }
+            if !found {
+                result.Add(k, v)
+            }
+        }
+    }
+    return result
 }
 
 func MakeUrl(uri string, query url.Values) string {
@@ -152,10 +237,38 @@ func MakeUrl(uri string, query url.Values) string {
     return fullUri
 }
 
+// FinalUrl returns the URL exactly as it was last requested, with encoded
+// parameters: that of the request the response answers when redirects were
+// followed, otherwise that of req.
+func FinalUrl(resp *http.Response, req *http.Request) string {
+    if resp != nil && resp.Request != nil && resp.Request.URL != nil {
+        return resp.Request.URL.String()
+    }
+    if req != nil && req.URL != nil {
+        return req.URL.String()
+    }
+    return ""
+}
+
+// decodeTokenResponse reads and closes the body of a JSON token response into
+// v, returning a TokenError instead if the body is an error, even with a 200.
+func decodeTokenResponse(r *http.Response, v interface{}) error {
+    defer r.Body.Close()
+    body_bytes, err := ioutil.ReadAll(r.Body)
+    if err != nil {
+        return err
+    }
+    if err = tokenErrorInBody(r.StatusCode, r.Header, string(body_bytes)); err != nil {
+        return err
+    }
+    return json.Unmarshal(body_bytes, v)
+}
+
 func MakeRequest(client OAuth2Client, req *http.Request) (*http.Response, *http.Request, error) {
     if req == nil || client == nil {
-        return nil, nil, nil
+        return nil, req, nil
     }
+    requestId := setCorrelationId(client, req)
     if mockClient, ok := client.(MockClient); ok {
         resp, err := mockClient.HandleRequest(req)
         return resp, req, err
@@ -168,7 +281,28 @@ func MakeRequest(client OAuth2Client, req *http.Request) (*http.Response, *http.
         dump, _ := httputil.DumpRequest(req, true)
         log.Print("Making Request:", "\n=================================\n", string(dump), "=================================\n")
     }
+    metrics := clientMetrics(client)
+    host := ""
+    if req.URL != nil {
+        host = req.URL.Host
+    }
+    if len(requestId) > 0 {
+        LogDebug("Sending ", req.Method, " ", host, " request ", requestId)
+        if m, ok := metrics.(RequestIdMetrics); ok {
+            m.OnRequestId(req.Method, host, requestId)
+        }
+    }
+    metrics.OnRequestStart(req.Method, host)
+    start := time.Now()
     resp, err := c.Do(req)
+    statusCode := 0
+    if resp != nil {
+        statusCode = resp.StatusCode
+    }
+    metrics.OnRequestComplete(req.Method, host, statusCode, time.Since(start), err)
+    if oauth1Client, ok := client.(OAuth1Client); ok {
+        oauth1LearnTimestampOffset(oauth1Client, resp, start)
+    }
     if EnableLogHttpResponses {
         if resp != nil {
             dump2, _ := httputil.DumpResponse(resp, true)
@@ -0,0 +1,79 @@
+package oauth2_client
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "reflect"
+    "testing"
+)
+
+func TestAuthorizedRequestMethodCase(t *testing.T) {
+    for _, tc := range []struct {
+        preserve bool
+        want     string
+    }{
+        {false, "PATCH"},
+        {true, "Patch"},
+    } {
+        p := newPhotosClient()
+        p.SetPreserveMethodCase(tc.preserve)
+        var method string
+        var verifyErr error
+        srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            method = r.Method
+            verifyErr = VerifyRequest(p, r, p.CurrentCredentials())
+        }))
+        resp, _, err := AuthorizedRequest(p, "Patch", nil, srv.URL+"/photos?size=original", nil, nil)
+        srv.Close()
+        if err != nil {
+            t.Fatal(err)
+        }
+        resp.Body.Close()
+        if method != tc.want {
+            t.Errorf("preserve %v: sent %q, want %q", tc.preserve, method, tc.want)
+        }
+        if verifyErr != nil {
+            t.Errorf("preserve %v: %v", tc.preserve, verifyErr)
+        }
+    }
+}
+
+// roundTripQuery has repeated keys out of order, empty values, a bare flag
+// and both encodings of a space.
+const roundTripQuery = "size=original&file=b.jpg&file=a.jpg&empty=&flag&sp=a%20b&plus=a+b&slash=%2F"
+
+func TestSplitUrlMakeUrlRoundTrip(t *testing.T) {
+    uri := "http://photos.example.net/photos?" + roundTripQuery
+    base, query := splitUrl(uri, nil)
+    if base != "http://photos.example.net/photos" {
+        t.Errorf("split off %q", base)
+    }
+    expected, _ := url.ParseQuery(roundTripQuery)
+    if !reflect.DeepEqual(query, expected) {
+        t.Errorf("split query %v, expected %v", query, expected)
+    }
+    // the signing paths add only the parameters that are not already in
+    // the query to the verbatim URL
+    if got := MakeUrl(uri, subtractValues(query, expected)); got != uri {
+        t.Errorf("MakeUrl without new parameters = %q, expected %q", got, uri)
+    }
+    _, merged := splitUrl(uri, url.Values{"page": {"2"}})
+    if got, want := MakeUrl(uri, subtractValues(merged, expected)), uri+"&page=2"; got != want {
+        t.Errorf("MakeUrl with a new parameter = %q, expected %q", got, want)
+    }
+}
+
+func TestSignedUrlKeepsQuery(t *testing.T) {
+    p := newPhotosClient()
+    req, err := oauth1CreateAuthorizedRequest(p, GET, nil, "http://photos.example.net/photos?"+roundTripQuery, nil, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if req.URL.RawQuery != roundTripQuery {
+        t.Errorf("sent query %q, expected %q", req.URL.RawQuery, roundTripQuery)
+    }
+    if err = VerifyRequest(p, req, p.CurrentCredentials()); err != nil {
+        t.Error(err)
+    }
+}
@@ -0,0 +1,54 @@
+package oauth2_client
+
+import (
+    "io/ioutil"
+    "net/http"
+    "net/url"
+    "strings"
+)
+
+// TokenRevoker is implemented by OAuth 2.0 clients whose provider supports
+// token revocation as described in RFC 7009, e.g. to log the user out.
+type TokenRevoker interface {
+    // RevokeToken invalidates token, which is a refresh token if isRefresh
+    // is true and an access token otherwise.
+    RevokeToken(token string, isRefresh bool) error
+}
+
+// oauth2RevokeToken posts token to the revocation endpoint, authenticating
+// the client with HTTP Basic authentication.  The provider answers 200 for
+// tokens it does not know as well, so only other statuses are errors: a
+// TokenError with the provider's error code, e.g. invalid_client for a 401
+// or unsupported_token_type for a 400.
+func oauth2RevokeToken(client OAuth2Client, method, endpoint, clientId, clientSecret, token string, isRefresh bool) error {
+    m := make(url.Values)
+    m.Set("token", token)
+    if isRefresh {
+        m.Set("token_type_hint", "refresh_token")
+    } else {
+        m.Set("token_type_hint", "access_token")
+    }
+    req, err := http.NewRequest(method, endpoint, strings.NewReader(m.Encode()))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", ACCEPT_FORM_ENCODED)
+    // RFC 6749 section 2.3.1 form-encodes the credentials first
+    req.SetBasicAuth(url.QueryEscape(clientId), url.QueryEscape(clientSecret))
+    resp, _, err := MakeRequest(client, req)
+    if err != nil {
+        return err
+    }
+    if resp == nil {
+        return nil
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode == http.StatusOK {
+        return nil
+    }
+    body, err := ioutil.ReadAll(resp.Body)
+    if err != nil {
+        return err
+    }
+    return newTokenErrorFromResponse(resp.StatusCode, resp.Header, string(body))
+}
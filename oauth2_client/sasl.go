@@ -0,0 +1,12 @@
+package oauth2_client
+
+import (
+    "encoding/base64"
+)
+
+// BuildXOAuth2String returns the initial client response for the SASL
+// XOAUTH2 mechanism used by IMAP and SMTP servers, i.e.
+// base64("user=" + user + "\x01auth=Bearer " + accessToken + "\x01\x01").
+func BuildXOAuth2String(user, accessToken string) string {
+    return base64.StdEncoding.EncodeToString([]byte("user=" + user + "\x01auth=Bearer " + accessToken + "\x01\x01"))
+}
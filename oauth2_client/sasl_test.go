@@ -0,0 +1,21 @@
+package oauth2_client
+
+import (
+    "encoding/base64"
+    "testing"
+)
+
+func TestBuildXOAuth2String(t *testing.T) {
+    // the example of the XOAUTH2 mechanism documentation
+    got := BuildXOAuth2String("someuser@example.com", "ya29.vF9dft4qmTc2Nvb3RlckBhdHRhdmlzdGEuY29tCg")
+    if expected := "dXNlcj1zb21ldXNlckBleGFtcGxlLmNvbQFhdXRoPUJlYXJlciB5YTI5LnZGOWRmdDRxbVRjMk52YjNSbGNrQmhkSFJoZG1semRHRXVZMjl0Q2cBAQ=="; got != expected {
+        t.Errorf("got %q, expected %q", got, expected)
+    }
+    decoded, err := base64.StdEncoding.DecodeString(got)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if expected := "user=someuser@example.com\x01auth=Bearer ya29.vF9dft4qmTc2Nvb3RlckBhdHRhdmlzdGEuY29tCg\x01\x01"; string(decoded) != expected {
+        t.Errorf("decodes to %q, expected %q", decoded, expected)
+    }
+}
@@ -0,0 +1,155 @@
+package oauth2_client
+
+import (
+    "crypto"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha1"
+    "crypto/sha256"
+    "crypto/sha512"
+    "encoding/base64"
+    "hash"
+    "strings"
+    "sync"
+)
+
+var (
+    signatureMethodsLock sync.RWMutex
+    signatureMethods     = map[string]SignatureMethodFunc{
+        HMAC_SHA1:   hmacSignatureMethod(HMAC_SHA1, crypto.SHA1),
+        HMAC_SHA256: hmacSignatureMethod(HMAC_SHA256, crypto.SHA256),
+        PLAINTEXT:   plaintextSignature,
+    }
+
+    hmacPoolsLock sync.Mutex
+    hmacPools     = make(map[hmacPoolKey]*sync.Pool)
+    hmacPoolSalt  = newHMACPoolSalt()
+)
+
+// hmacPoolKey identifies a pool by a salted digest of the signing key, so
+// that the secrets are not kept as map keys.
+type hmacPoolKey struct {
+    method string
+    digest [sha256.Size]byte
+}
+
+func newHMACPoolSalt() []byte {
+    salt := make([]byte, 16)
+    rand.Read(salt)
+    return salt
+}
+
+// SignatureMethodFunc computes the oauth_signature value for the given
+// signature base string and signing key.
+type SignatureMethodFunc func(baseString, key string) string
+
+// RegisterSignatureMethod makes fn available as the signer for the
+// oauth_signature_method value name.  Registering a name that already
+// exists replaces the previous signer, including the built-in ones.
+func RegisterSignatureMethod(name string, fn func(baseString, key string) string) {
+    signatureMethodsLock.Lock()
+    defer signatureMethodsLock.Unlock()
+    if fn == nil {
+        delete(signatureMethods, name)
+        return
+    }
+    signatureMethods[name] = fn
+}
+
+// RegisterHMACSignatureMethod registers name as an HMAC signature method
+// using the hash h, e.g. "HMAC-SHA512" with crypto.SHA512.  The package
+// implementing h must be linked in, as crypto/sha512 is for SHA-384 and
+// SHA-512, or ErrUnavailableHash is returned.
+func RegisterHMACSignatureMethod(name string, h crypto.Hash) error {
+    if !h.Available() {
+        return ErrUnavailableHash
+    }
+    RegisterSignatureMethod(name, hmacSignatureMethod(name, h))
+    return nil
+}
+
+// ComputeSignature applies the registered signature method to a caller
+// supplied signature base string and signing key, e.g. to check that another
+// OAuth library produces the same oauth_signature for the same input.
+func ComputeSignature(method, baseString, signingKey string) (string, error) {
+    signer := lookupSignatureMethod(method)
+    if signer == nil {
+        return "", ErrUnknownSignatureMethod
+    }
+    return signer(baseString, signingKey), nil
+}
+
+func lookupSignatureMethod(name string) SignatureMethodFunc {
+    signatureMethodsLock.RLock()
+    defer signatureMethodsLock.RUnlock()
+    return signatureMethods[name]
+}
+
+// hmacPool returns the pool of HMAC hashers already keyed with key, so that
+// signing many requests with the same credentials does not set up the key
+// for each of them.  Once _HMAC_POOL_LIMIT keys have pools, all of them are
+// dropped and the pools start over.  The pool has no New function, which
+// would have to hold on to key; hmacSignature creates the hashers instead.
+func hmacPool(method string, key string) *sync.Pool {
+    var buf [128]byte
+    salted := append(append(buf[:0], hmacPoolSalt...), key...)
+    poolKey := hmacPoolKey{method: method, digest: sha256.Sum256(salted)}
+    hmacPoolsLock.Lock()
+    defer hmacPoolsLock.Unlock()
+    if pool, ok := hmacPools[poolKey]; ok {
+        return pool
+    }
+    if len(hmacPools) >= _HMAC_POOL_LIMIT {
+        // cheaper than tracking which keys were used last
+        hmacPools = make(map[hmacPoolKey]*sync.Pool)
+    }
+    pool := new(sync.Pool)
+    hmacPools[poolKey] = pool
+    return pool
+}
+
+func hmacSignature(method string, h func() hash.Hash, baseString, key string) string {
+    pool := hmacPool(method, key)
+    mac, ok := pool.Get().(hash.Hash)
+    if ok {
+        mac.Reset()
+    } else {
+        mac = hmac.New(h, []byte(key))
+    }
+    mac.Write([]byte(baseString))
+    var buf [sha512.Size]byte
+    sum := mac.Sum(buf[:0])
+    pool.Put(mac)
+
+    encodedSum := make([]byte, base64.StdEncoding.EncodedLen(len(sum)))
+    base64.StdEncoding.Encode(encodedSum, sum)
+    return strings.TrimSpace(string(encodedSum))
+}
+
+// hmacSignatureMethod returns the signer for the HMAC signature method name
+// using the hash h.
+func hmacSignatureMethod(name string, h crypto.Hash) SignatureMethodFunc {
+    return func(baseString, key string) string {
+        return hmacSignature(name, h.New, baseString, key)
+    }
+}
+
+// NewRSASHA1Signer returns a DelegatedSigner that computes RSA-SHA1
+// signatures with signer, e.g. the crypto.Signer of an HSM or cloud KMS SDK,
+// so that the private key never has to be loaded into this process.  An
+// *rsa.PrivateKey works as well.  Use it with SetSignatureMethod(RSA_SHA1).
+func NewRSASHA1Signer(signer crypto.Signer) DelegatedSigner {
+    return func(baseString string) (string, string) {
+        digest := sha1.Sum([]byte(baseString))
+        sig, err := signer.Sign(rand.Reader, digest[:], crypto.SHA1)
+        if err != nil {
+            LogError("Unable to compute the RSA-SHA1 signature: ", err)
+            return "", RSA_SHA1
+        }
+        return base64.StdEncoding.EncodeToString(sig), RSA_SHA1
+    }
+}
+
+func plaintextSignature(baseString, key string) string {
+    return key
+}
@@ -0,0 +1,68 @@
+package oauth2_client
+
+import (
+    "crypto/hmac"
+    "crypto/sha1"
+    "encoding/base64"
+    "strconv"
+    "sync"
+    "testing"
+)
+
+func TestHMACSignatureConcurrent(t *testing.T) {
+    var wg sync.WaitGroup
+    for g := 0; g < 8; g++ {
+        wg.Add(1)
+        go func(g int) {
+            defer wg.Done()
+            for i := 0; i < 200; i++ {
+                key := "consumer-secret&token-secret-" + strconv.Itoa((g+i)%4)
+                message := "GET&http%3A%2F%2Fexample.com%2F&n%3D" + strconv.Itoa(i)
+                mac := hmac.New(sha1.New, []byte(key))
+                mac.Write([]byte(message))
+                want := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+                if got := lookupSignatureMethod(HMAC_SHA1)(message, key); got != want {
+                    t.Errorf("signature of %q with %q = %s, want %s", message, key, got, want)
+                    return
+                }
+            }
+        }(g)
+    }
+    wg.Wait()
+}
+
+const benchmarkBaseString = "GET&http%3A%2F%2Fphotos.example.net%2Fphotos&file%3Dvacation.jpg%26" +
+    "oauth_consumer_key%3Ddpf43f3p2l4k3l03%26oauth_nonce%3Dkllo9940pd9333jh%26" +
+    "oauth_signature_method%3DHMAC-SHA1%26oauth_timestamp%3D1191242096%26" +
+    "oauth_token%3Dnnch734d00sl2jdk%26oauth_version%3D1.0%26size%3Doriginal"
+
+const benchmarkKey = "kd94hf93k423kf44&pfkkdhi9sl3r4s00"
+
+// BenchmarkHMACSignatureUnpooled is the cost of keying a new HMAC for each
+// signature, to compare BenchmarkHMACSignature with.
+func BenchmarkHMACSignatureUnpooled(b *testing.B) {
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        mac := hmac.New(sha1.New, []byte(benchmarkKey))
+        mac.Write([]byte(benchmarkBaseString))
+        base64.StdEncoding.EncodeToString(mac.Sum(nil))
+    }
+}
+
+func BenchmarkHMACSignature(b *testing.B) {
+    signer := lookupSignatureMethod(HMAC_SHA1)
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        signer(benchmarkBaseString, benchmarkKey)
+    }
+}
+
+func BenchmarkHMACSignatureParallel(b *testing.B) {
+    signer := lookupSignatureMethod(HMAC_SHA1)
+    b.ReportAllocs()
+    b.RunParallel(func(pb *testing.PB) {
+        for pb.Next() {
+            signer(benchmarkBaseString, benchmarkKey)
+        }
+    })
+}
@@ -2,7 +2,6 @@ package oauth2_client
 
 import (
     "encoding/json"
-    "errors"
     "github.com/pomack/jsonhelper.go/jsonhelper"
     "io"
     "net/http"
@@ -82,10 +81,7 @@ type SmugMugAccessTokenResult interface {
 }
 
 type smugMugAccessTokenResult struct {
-    stdAuthToken
-    guid          string
-    sessionHandle string
-    expiresAt     time.Time
+    tokenFields
 }
 
 func (p *smugMugAccessTokenResult) Guid() string          { return p.guid }
@@ -132,7 +128,7 @@ func (p *smugMugClient) Initialize(properties jsonhelper.JSONObject) {
         p.callbackUrl = v
     }
     if v := properties.GetAsString("smugmug.oauth1.scope"); len(v) > 0 {
-        //p.Scope = v
+        p.scopes = parseScopes(v)
     }
     if v := properties.GetAsString("smugmug.client.token"); len(v) > 0 {
         p.currentCredentials.SetToken(v)
@@ -161,7 +157,7 @@ func (p *smugMugClient) CreateAuthorizedRequest(method string, headers http.Head
 func (p *smugMugClient) ParseRequestTokenResult(value string) (AuthToken, error) {
     LogDebug("+++++++++++++++++++++++++++++++")
     LogDebug("SmugMug! Client parsing request token result")
-    t, err := defaultOAuth1ParseAuthToken(value)
+    t, err := defaultOAuth1ParseRequestToken(value)
     LogDebug("+++++++++++++++++++++++++++++++")
     return t, err
 }
@@ -170,7 +166,7 @@ func (p *smugMugClient) ParseAccessTokenResult(value string) (AuthToken, error)
     LogDebug("+++++++++++++++++++++++++++++++")
     LogDebug("SmugMug! Client parsing access token result")
     t := new(smugMugAccessTokenResult)
-    m, err := url.ParseQuery(value)
+    m, err := ParseTokenResponse(value)
     if m != nil {
         t.token = m.Get("oauth_token")
         t.secret = m.Get("oauth_token_secret")
@@ -182,7 +178,7 @@ func (p *smugMugClient) ParseAccessTokenResult(value string) (AuthToken, error)
             t.expiresAt = time.Now().Add(time.Second * time.Duration(expiresIn)).UTC()
         }
         if err == nil && len(m.Get("oauth_problem")) > 0 {
-            err = errors.New(m.Get("oauth_problem"))
+            err = newProblemError(m.Get("oauth_problem"))
         }
     }
     LogDebug("+++++++++++++++++++++++++++++++")
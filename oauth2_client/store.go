@@ -0,0 +1,138 @@
+package oauth2_client
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "sync"
+    "time"
+)
+
+// EphemeralStore keeps short-lived values between the redirect to the
+// provider and the callback: the OAuth 1.0 request token secrets and the
+// OAuth 2.0 state values.  Replace DefaultEphemeralStore with an
+// implementation backed by a shared cache, such as Redis or memcached, when
+// the callback may be handled by another process than the redirect.
+type EphemeralStore interface {
+    // Put stores value under key until ttl has elapsed.
+    Put(key, value string, ttl time.Duration) error
+    // Get returns the value stored under key, with ok=false if there is none
+    // or it has expired.
+    Get(key string) (value string, ok bool, err error)
+    // Delete removes key, if present.
+    Delete(key string) error
+}
+
+// DefaultEphemeralStore is the store used by both the OAuth 1.0 and the
+// OAuth 2.0 flows.  It defaults to an in-memory store.
+var DefaultEphemeralStore EphemeralStore = NewMemoryStore()
+
+type memoryStoreEntry struct {
+    value   string
+    expires time.Time
+}
+
+type memoryStore struct {
+    lock      sync.Mutex
+    entries   map[string]memoryStoreEntry
+    lastSweep time.Time
+}
+
+// NewMemoryStore returns an EphemeralStore that keeps the values in this
+// process.
+func NewMemoryStore() EphemeralStore {
+    return &memoryStore{entries: make(map[string]memoryStoreEntry)}
+}
+
+func (p *memoryStore) Put(key, value string, ttl time.Duration) error {
+    now := time.Now()
+    p.lock.Lock()
+    defer p.lock.Unlock()
+    // drop expired values now and then, since most are never read again
+    if now.Sub(p.lastSweep) >= time.Minute {
+        for k, entry := range p.entries {
+            if !now.Before(entry.expires) {
+                delete(p.entries, k)
+            }
+        }
+        p.lastSweep = now
+    }
+    p.entries[key] = memoryStoreEntry{value: value, expires: now.Add(ttl)}
+    return nil
+}
+
+func (p *memoryStore) Get(key string) (string, bool, error) {
+    p.lock.Lock()
+    defer p.lock.Unlock()
+    entry, ok := p.entries[key]
+    if !ok {
+        return "", false, nil
+    }
+    if !time.Now().Before(entry.expires) {
+        delete(p.entries, key)
+        return "", false, nil
+    }
+    return entry.value, true, nil
+}
+
+func (p *memoryStore) Delete(key string) error {
+    p.lock.Lock()
+    defer p.lock.Unlock()
+    delete(p.entries, key)
+    return nil
+}
+
+// oauth1StoreTokenSecret remembers the secret of token until the callback.
+func oauth1StoreTokenSecret(token, secret string) {
+    if err := DefaultEphemeralStore.Put(_OAUTH1_SECRET_KEY_PREFIX+token, secret, _OAUTH1_TOKEN_SECRET_TTL); err != nil {
+        LogErrorf("Unable to store the token secret for %q: %v", token, err)
+    }
+}
+
+// oauth1LookupTokenSecret returns the secret stored for token, or "".
+func oauth1LookupTokenSecret(token string) string {
+    secret, _ := oauth1LookupStoredToken(token)
+    return secret
+}
+
+// oauth1LookupStoredToken is like oauth1LookupTokenSecret, but also reports
+// whether token was stored at all, since its secret may be empty.
+func oauth1LookupStoredToken(token string) (string, bool) {
+    secret, ok, err := DefaultEphemeralStore.Get(_OAUTH1_SECRET_KEY_PREFIX + token)
+    if err != nil {
+        LogErrorf("Unable to look up the token secret for %q: %v", token, err)
+    }
+    if !ok {
+        return "", false
+    }
+    return secret, true
+}
+
+// NewOAuth2State returns a random state value for an OAuth 2.0 authorization
+// request and keeps data, e.g. the page to return to or a PKCE code
+// verifier, in DefaultEphemeralStore until ConsumeOAuth2State is called with
+// the state sent back to the callback.
+func NewOAuth2State(data string) (string, error) {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    state := hex.EncodeToString(b)
+    if err := DefaultEphemeralStore.Put(_OAUTH2_STATE_KEY_PREFIX+state, data, _OAUTH2_STATE_TTL); err != nil {
+        return "", err
+    }
+    return state, nil
+}
+
+// ConsumeOAuth2State returns the data stored by NewOAuth2State for state and
+// removes it, so that each state is only accepted once.  It returns ok=false
+// for an unknown or expired state.
+func ConsumeOAuth2State(state string) (data string, ok bool, err error) {
+    if len(state) <= 0 {
+        return "", false, nil
+    }
+    key := _OAUTH2_STATE_KEY_PREFIX + state
+    if data, ok, err = DefaultEphemeralStore.Get(key); err != nil || !ok {
+        return "", false, err
+    }
+    return data, true, DefaultEphemeralStore.Delete(key)
+}
@@ -0,0 +1,77 @@
+package oauth2_client
+
+import (
+    "crypto/tls"
+    "errors"
+    "net/http"
+    "strconv"
+)
+
+// TransportClient is implemented by clients whose connection pool can be
+// tuned.  The settings apply to the *http.Client returned by Client(), so
+// they cover the token exchanges as well as authorized requests.
+type TransportClient interface {
+    SetMaxIdleConnsPerHost(value int)
+    SetForceHTTP1(value bool)
+    SetMaxRedirects(value int)
+}
+
+// tunableTransport returns the *http.Transport of client, replacing the
+// shared http.DefaultTransport with a private copy first so that tuning it
+// does not affect other clients.  It returns nil for a custom RoundTripper.
+func tunableTransport(client *http.Client) *http.Transport {
+    if client == nil {
+        return nil
+    }
+    if client.Transport == nil || client.Transport == http.DefaultTransport {
+        client.Transport = http.DefaultTransport.(*http.Transport).Clone()
+    }
+    transport, ok := client.Transport.(*http.Transport)
+    if !ok {
+        LogErrorf("Cannot tune custom transport %T", client.Transport)
+        return nil
+    }
+    return transport
+}
+
+func setMaxIdleConnsPerHost(client *http.Client, value int) {
+    if transport := tunableTransport(client); transport != nil {
+        transport.MaxIdleConnsPerHost = value
+    }
+}
+
+// setForceHTTP1 disables or re-enables HTTP/2 over TLS.
+func setForceHTTP1(client *http.Client, value bool) {
+    if transport := tunableTransport(client); transport != nil {
+        if value {
+            // a non-nil, empty map turns off the automatic HTTP/2 upgrade
+            transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+            transport.ForceAttemptHTTP2 = false
+        } else {
+            transport.TLSNextProto = nil
+            transport.ForceAttemptHTTP2 = true
+        }
+    }
+}
+
+// setMaxRedirects makes client follow at most value redirects, failing the
+// request once there are more.  With 0 the redirect response itself is
+// returned, and a negative value restores the net/http default of 10.
+func setMaxRedirects(client *http.Client, value int) {
+    if client == nil {
+        return
+    }
+    if value < 0 {
+        client.CheckRedirect = nil
+        return
+    }
+    client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+        if value == 0 {
+            return http.ErrUseLastResponse
+        }
+        if len(via) >= value {
+            return errors.New("Stopped after " + strconv.Itoa(value) + " redirects")
+        }
+        return nil
+    }
+}
@@ -2,7 +2,6 @@ package oauth2_client
 
 import (
     "encoding/json"
-    "errors"
     "github.com/pomack/jsonhelper.go/jsonhelper"
     "io"
     "net/http"
@@ -22,16 +21,13 @@ type TwitterAccessTokenResult interface {
 }
 
 type twitterRequestTokenResult struct {
-    stdAuthToken
-    callbackConfirmed bool
+    requestTokenFields
 }
 
 func (p *twitterRequestTokenResult) CallbackConfirmed() bool { return p.callbackConfirmed }
 
 type twitterAccessTokenResult struct {
-    stdAuthToken
-    userId     string
-    screenName string
+    tokenFields
 }
 
 func (p *twitterAccessTokenResult) UserId() string     { return p.userId }
@@ -121,8 +117,18 @@ func (p *twitterUserInfoResult) FromJSON(props jsonhelper.JSONObject) {
     p.following = props.GetAsBool("following")
 }
 
+// TwitterClient exposes the sign-in options of Twitter's authorize step.
+type TwitterClient interface {
+    OAuth1Client
+    UseAuthenticate() bool
+    SetUseAuthenticate(value bool)
+    SetForceLogin(value bool)
+    SetScreenName(screenName string)
+}
+
 type twitterClient struct {
     stdOAuth1Client
+    useAuthenticate bool
 }
 
 func NewTwitterClient() OAuth2Client {
@@ -135,7 +141,34 @@ func (p *twitterClient) RequestUrlProtected() bool { return _TWITTER_REQUEST_TOK
 func (p *twitterClient) AccessUrl() string         { return _TWITTER_ACCESS_TOKEN_URL }
 func (p *twitterClient) AccessUrlMethod() string   { return _TWITTER_ACCESS_TOKEN_METHOD }
 func (p *twitterClient) AccessUrlProtected() bool  { return _TWITTER_ACCESS_TOKEN_PROTECTED }
-func (p *twitterClient) AuthorizationUrl() string  { return _TWITTER_AUTHORIZATION_PATH_URL }
+func (p *twitterClient) AuthorizationUrl() string {
+    if p.useAuthenticate {
+        return _TWITTER_AUTHENTICATE_PATH_URL
+    }
+    return _TWITTER_AUTHORIZATION_PATH_URL
+}
+
+// UseAuthenticate reports whether the user is sent to /oauth/authenticate,
+// which skips the approval screen for users that already authorized the
+// application, rather than to /oauth/authorize.
+func (p *twitterClient) UseAuthenticate() bool         { return p.useAuthenticate }
+func (p *twitterClient) SetUseAuthenticate(value bool) { p.useAuthenticate = value }
+
+// SetForceLogin makes Twitter ask for the user's credentials even if a user
+// is already signed in.
+func (p *twitterClient) SetForceLogin(value bool) {
+    if value {
+        p.SetAuthorizationUrlParam("force_login", "true")
+    } else {
+        p.SetAuthorizationUrlParam("force_login", "")
+    }
+}
+
+// SetScreenName prefills the screen name on the login form, or clears it when
+// screenName is empty.
+func (p *twitterClient) SetScreenName(screenName string) {
+    p.SetAuthorizationUrlParam("screen_name", screenName)
+}
 func (p *twitterClient) AuthorizedResourceProtected() bool {
     return _TWITTER_AUTHORIZED_RESOURCE_PROTECTED
 }
@@ -159,7 +192,16 @@ func (p *twitterClient) Initialize(properties jsonhelper.JSONObject) {
         p.callbackUrl = v
     }
     if v := properties.GetAsString("twitter.oauth1.scope"); len(v) > 0 {
-        //p.Scope = v
+        p.scopes = parseScopes(v)
+    }
+    if properties.GetAsBool("twitter.oauth1.authenticate") {
+        p.useAuthenticate = true
+    }
+    if properties.GetAsBool("twitter.oauth1.force_login") {
+        p.SetForceLogin(true)
+    }
+    if v := properties.GetAsString("twitter.oauth1.screen_name"); len(v) > 0 {
+        p.SetScreenName(v)
     }
     if v := properties.GetAsString("twitter.client.token"); len(v) > 0 {
         p.currentCredentials.SetToken(v)
@@ -189,13 +231,13 @@ func (p *twitterClient) ParseRequestTokenResult(value string) (AuthToken, error)
     LogDebug("+++++++++++++++++++++++++++++++")
     LogDebug("Twitter Client parsing request token result")
     t := new(twitterRequestTokenResult)
-    m, err := url.ParseQuery(value)
+    m, err := ParseTokenResponse(value)
     if m != nil {
         t.token = m.Get("oauth_token")
         t.secret = m.Get("oauth_token_secret")
         t.callbackConfirmed = m.Get("oauth_callback_confirmed") == "true"
         if err == nil && len(m.Get("oauth_problem")) > 0 {
-            err = errors.New(m.Get("oauth_problem"))
+            err = newProblemError(m.Get("oauth_problem"))
         }
     }
     LogDebug("+++++++++++++++++++++++++++++++")
@@ -206,14 +248,14 @@ func (p *twitterClient) ParseAccessTokenResult(value string) (AuthToken, error)
     LogDebug("+++++++++++++++++++++++++++++++")
     LogDebug("Twitter Client parsing access token result")
     t := new(twitterAccessTokenResult)
-    m, err := url.ParseQuery(value)
+    m, err := ParseTokenResponse(value)
     if m != nil {
         t.token = m.Get("oauth_token")
         t.secret = m.Get("oauth_token_secret")
         t.userId = m.Get("user_id")
         t.screenName = m.Get("screen_name")
         if err == nil && len(m.Get("oauth_problem")) > 0 {
-            err = errors.New(m.Get("oauth_problem"))
+            err = newProblemError(m.Get("oauth_problem"))
         }
     }
     LogDebug("+++++++++++++++++++++++++++++++")
@@ -0,0 +1,130 @@
+package oauth2_client
+
+import (
+    "crypto/subtle"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strings"
+)
+
+// VerifyRequest checks the signature of req the way a provider would, with
+// the consumer secret of p and the secret of credentials.  The protocol
+// parameters are read from the Authorization header, or else from the
+// query, and are signed together with the query and the fields of a
+// form-encoded body as described in RFC 5849 section 3.4.1.3.  The URL is
+// taken from req.Host and req.TLS, or from the forwarded headers by
+// ExternalRequestUrl if p.TrustForwardedHeaders().  Only
+// signatures computed from the secrets, such as HMAC-SHA1 and PLAINTEXT,
+// can be verified; others return ErrUnverifiableSignature.
+func VerifyRequest(p OAuth1Client, req *http.Request, credentials AuthToken) error {
+    if req == nil || req.URL == nil {
+        return errors.New("Request cannot be nil")
+    }
+    params := req.URL.Query()
+    if authorization := req.Header.Get("Authorization"); len(authorization) > 0 {
+        headerParams, err := ParseAuthorizationHeader(authorization)
+        if err != nil {
+            return err
+        }
+        // the same values may be duplicated in the query
+        for k, arr := range headerParams {
+            params[k] = arr
+        }
+    }
+    if !isBodilessMethod(req.Method) && strings.HasPrefix(req.Header.Get("Content-Type"), ACCEPT_FORM_ENCODED) {
+        body_bytes, err := readRequestBody(req)
+        if err != nil {
+            return err
+        }
+        form, err := url.ParseQuery(string(body_bytes))
+        if err != nil {
+            return err
+        }
+        for k, arr := range form {
+            params[k] = append(params[k], arr...)
+        }
+    }
+    signature := params.Get("oauth_signature")
+    if len(signature) <= 0 {
+        return ErrMissingSignature
+    }
+    signer := lookupSignatureMethod(params.Get("oauth_signature_method"))
+    if signer == nil {
+        return ErrUnverifiableSignature
+    }
+    params.Del("oauth_signature")
+    params.Del("realm")
+    u := incomingRequestUrl(req)
+    if p.TrustForwardedHeaders() {
+        u = ExternalRequestUrl(req)
+    }
+    u.RawQuery = ""
+    method := strings.ToUpper(req.Method)
+    if p.PreserveMethodCase() {
+        method = req.Method
+    }
+    message := p.BaseStringBuilder().Build(method, u.String(), params)
+    key, _ := oauth1SigningKey(p, credentials)
+    if subtle.ConstantTimeCompare([]byte(signer(message, key)), []byte(signature)) != 1 {
+        LogDebug("Signature \"", signature, "\" does not match message: \"", message, "\"")
+        return ErrInvalidSignature
+    }
+    return nil
+}
+
+// ExternalRequestUrl returns the URL of req as its sender saw it before a
+// reverse proxy or load balancer: the URL of incomingRequestUrl with the host
+// and scheme replaced by X-Forwarded-Host and X-Forwarded-Proto, if set.  For
+// a chain of proxies the first value, from the proxy nearest the client,
+// wins.  These headers can be forged by anyone who reaches the service
+// without passing through the proxy, so they should only be trusted behind
+// one.
+func ExternalRequestUrl(req *http.Request) *url.URL {
+    u := incomingRequestUrl(req)
+    if proto := forwardedHeader(req.Header, "X-Forwarded-Proto"); len(proto) > 0 {
+        u.Scheme = strings.ToLower(proto)
+    }
+    if host := forwardedHeader(req.Header, "X-Forwarded-Host"); len(host) > 0 {
+        u.Host = host
+    }
+    return u
+}
+
+// incomingRequestUrl returns the URL of req as received.  An incoming
+// request only has the path in req.URL, so the host comes from req.Host and
+// the scheme from req.TLS.
+func incomingRequestUrl(req *http.Request) *url.URL {
+    u := *req.URL
+    u.Fragment = ""
+    if len(req.Host) > 0 {
+        u.Host = req.Host
+    }
+    if len(u.Scheme) <= 0 {
+        if req.TLS != nil {
+            u.Scheme = "https"
+        } else {
+            u.Scheme = "http"
+        }
+    }
+    return &u
+}
+
+// forwardedHeader returns the first entry of the comma-separated header.
+func forwardedHeader(header http.Header, key string) string {
+    return strings.TrimSpace(strings.SplitN(header.Get(key), ",", 2)[0])
+}
+
+// oauth1SelfVerify checks a request that was just signed with VerifyRequest,
+// skipping the cases it cannot check: delegated signers and protocol
+// parameters in a JSON body.
+func oauth1SelfVerify(p OAuth1Client, credentials AuthToken, req *http.Request) error {
+    if p.Signer() != nil || p.ParamLocation() == PARAMS_IN_JSON_BODY {
+        return nil
+    }
+    if err := VerifyRequest(p, req, credentials); err != nil && err != ErrUnverifiableSignature {
+        return fmt.Errorf("%w: %v", ErrSelfVerifyFailed, err)
+    }
+    return nil
+}
@@ -0,0 +1,40 @@
+package oauth2_client
+
+import (
+    "net/http/httptest"
+    "net/url"
+    "testing"
+)
+
+func TestVerifyForwardedHeaders(t *testing.T) {
+    p := newPhotosClient()
+    signed, err := oauth1CreateAuthorizedRequest(p, GET, nil, "https://api.example.com/photos", url.Values{"file": {"vacation.jpg"}}, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    receive := func(target string, forwarded bool) error {
+        req := httptest.NewRequest(GET, target, nil)
+        req.Header.Set("Authorization", signed.Header.Get("Authorization"))
+        if forwarded {
+            req.Header.Set("X-Forwarded-Proto", "https")
+            req.Header.Set("X-Forwarded-Host", "api.example.com, proxy.internal")
+        }
+        return VerifyRequest(p, req, p.CurrentCredentials())
+    }
+    // received directly, the URL comes from the Host and the TLS state
+    if err = receive("https://api.example.com/photos?file=vacation.jpg", false); err != nil {
+        t.Errorf("direct request: %v", err)
+    }
+    // forwarded headers are ignored unless trusted, so a request captured
+    // for one host does not verify on another
+    if err = receive("http://internal.example.com:8080/photos?file=vacation.jpg", true); err != ErrInvalidSignature {
+        t.Errorf("untrusted forwarded request: expected ErrInvalidSignature, got %v", err)
+    }
+    p.SetTrustForwardedHeaders(true)
+    if err = receive("http://internal.example.com:8080/photos?file=vacation.jpg", true); err != nil {
+        t.Errorf("trusted forwarded request: %v", err)
+    }
+    if err = receive("http://internal.example.com:8080/photos?file=vacation.jpg", false); err != ErrInvalidSignature {
+        t.Errorf("trusted request without forwarded headers: expected ErrInvalidSignature, got %v", err)
+    }
+}
@@ -2,7 +2,6 @@ package oauth2_client
 
 import (
     "encoding/json"
-    "errors"
     "github.com/pomack/jsonhelper.go/jsonhelper"
     "io"
     "net/http"
@@ -62,10 +61,7 @@ type YahooUserInfoResult interface {
 }
 
 type yahooRequestTokenResult struct {
-    stdAuthToken
-    requestAuthUrl    string
-    expiresAt         time.Time
-    callbackConfirmed bool
+    requestTokenFields
 }
 
 func (p *yahooRequestTokenResult) RequestAuthUrl() string  { return p.requestAuthUrl }
@@ -73,10 +69,7 @@ func (p *yahooRequestTokenResult) ExpiresAt() time.Time    { return p.expiresAt
 func (p *yahooRequestTokenResult) CallbackConfirmed() bool { return p.callbackConfirmed }
 
 type yahooAccessTokenResult struct {
-    stdAuthToken
-    guid          string
-    sessionHandle string
-    expiresAt     time.Time
+    tokenFields
 }
 
 func (p *yahooAccessTokenResult) Guid() string          { return p.guid }
@@ -230,7 +223,7 @@ func (p *yahooClient) Initialize(properties jsonhelper.JSONObject) {
         p.callbackUrl = v
     }
     if v := properties.GetAsString("yahoo.oauth1.scope"); len(v) > 0 {
-        //p.Scope = v
+        p.scopes = parseScopes(v)
     }
     if v := properties.GetAsString("yahoo.client.token"); len(v) > 0 {
         p.currentCredentials.SetToken(v)
@@ -263,7 +256,7 @@ func (p *yahooClient) ParseRequestTokenResult(value string) (AuthToken, error) {
     LogDebug("+++++++++++++++++++++++++++++++")
     LogDebug("Yahoo! Client parsing request token result")
     t := new(yahooRequestTokenResult)
-    m, err := url.ParseQuery(value)
+    m, err := ParseTokenResponse(value)
     if m != nil {
         t.token = m.Get("oauth_token")
         t.secret = m.Get("oauth_token_secret")
@@ -275,7 +268,7 @@ func (p *yahooClient) ParseRequestTokenResult(value string) (AuthToken, error) {
             t.expiresAt = time.Now().Add(time.Second * time.Duration(expiresIn)).UTC()
         }
         if err == nil && len(m.Get("oauth_problem")) > 0 {
-            err = errors.New(m.Get("oauth_problem"))
+            err = newProblemError(m.Get("oauth_problem"))
         }
     }
     LogDebug("+++++++++++++++++++++++++++++++")
@@ -286,7 +279,7 @@ func (p *yahooClient) ParseAccessTokenResult(value string) (AuthToken, error) {
     LogDebug("+++++++++++++++++++++++++++++++")
     LogDebug("Yahoo! Client parsing access token result")
     t := new(yahooAccessTokenResult)
-    m, err := url.ParseQuery(value)
+    m, err := ParseTokenResponse(value)
     if m != nil {
         t.token = m.Get("oauth_token")
         t.secret = m.Get("oauth_token_secret")
@@ -304,7 +297,7 @@ func (p *yahooClient) ParseAccessTokenResult(value string) (AuthToken, error) {
             t.expiresAt = time.Now().Add(time.Second * time.Duration(expiresIn)).UTC()
         }
         if err == nil && len(m.Get("oauth_problem")) > 0 {
-            err = errors.New(m.Get("oauth_problem"))
+            err = newProblemError(m.Get("oauth_problem"))
         }
     }
     LogDebug("+++++++++++++++++++++++++++++++")